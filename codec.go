@@ -0,0 +1,306 @@
+package pix
+
+import (
+	"errors"
+	"image/color"
+)
+
+// Codec reads and writes single pixels of a [Shape] stored in packed row data.
+// Pixels are exchanged as [color.RGBA64] values which are alpha-premultiplied and
+// normalized to 16 bits per channel regardless of the bit depth of the shape.
+//
+// Shapes without an alpha channel store the premultiplied color channels, which is
+// equivalent to compositing over black. Grayscale shapes store the luminance of the color.
+type Codec struct {
+	// Decode reads pixel number x of a packed row.
+	Decode func(row []byte, x int) color.RGBA64
+	// Encode writes pixel number x of a packed row.
+	// Bits belonging to neighboring pixels in sub-byte shapes are preserved.
+	Encode func(row []byte, x int, c color.RGBA64)
+}
+
+// codecs is the per-shape codec table indexed by [Shape].
+var codecs = [...]Codec{
+	ShapeRGB888:        {Decode: decodeRGB888, Encode: encodeRGB888},
+	ShapeRGBA8888:      {Decode: decodeRGBA8888, Encode: encodeRGBA8888},
+	ShapeRGB565BE:      {Decode: decodeRGB565BE, Encode: encodeRGB565BE},
+	ShapeRGB555:        {Decode: decodeRGB555, Encode: encodeRGB555},
+	ShapeRGB444BE:      {Decode: decodeRGB444BE, Encode: encodeRGB444BE},
+	ShapeGrayscale2bit: {Decode: decodeGray2, Encode: encodeGray2},
+	ShapeMonochrome:    {Decode: decodeMonochrome, Encode: encodeMonochrome},
+	ShapeNRGBA8888:     {Decode: decodeNRGBA8888, Encode: encodeNRGBA8888},
+	ShapeGrayscale8bit: {Decode: decodeGray8, Encode: encodeGray8},
+	ShapeGrayscale16BE: {Decode: decodeGray16BE, Encode: encodeGray16BE},
+}
+
+// Codec returns the pixel codec of the shape. ok is false for undefined and application defined shapes.
+//
+// Byte-aligned shapes share the memory layout of their standard library counterpart:
+// RGBA8888 is alpha-premultiplied like [image.RGBA], NRGBA8888 is not alpha-premultiplied like [image.NRGBA],
+// Grayscale8bit is laid out like [image.Gray] and Grayscale16BE is big-endian like [image.Gray16].
+//
+// Sub-byte and non byte-aligned shapes are packed most significant bit first,
+// so pixel x of a row starts at bit x*BitsPerPixel counting from the MSB of the first byte:
+//   - RGB565BE: RRRRRGGG GGGBBBBB.
+//   - RGB555: 15 bit RRRRRGGGGGBBBBB packed back to back with no padding bit.
+//   - RGB444BE: RRRRGGGG BBBBRRRR GGGGBBBB stores two pixels in three bytes.
+//   - Grayscale2bit: four pixels per byte, 0 is black and 3 is white.
+//   - Monochrome: eight pixels per byte, a set bit is white.
+func (sh Shape) Codec() (c Codec, ok bool) {
+	if sh < 0 || int(sh) >= len(codecs) || codecs[sh].Decode == nil {
+		return Codec{}, false
+	}
+	return codecs[sh], true
+}
+
+// DecodeRow decodes len(dst) pixels of row starting at pixel x0.
+func (c Codec) DecodeRow(dst []color.RGBA64, row []byte, x0 int) {
+	for i := range dst {
+		dst[i] = c.Decode(row, x0+i)
+	}
+}
+
+// EncodeRow encodes src into row starting at pixel x0.
+func (c Codec) EncodeRow(row []byte, x0 int, src []color.RGBA64) {
+	for i := range src {
+		c.Encode(row, x0+i, src[i])
+	}
+}
+
+// GetPixel reads the pixel at (x,y) of img. Only the bytes containing the pixel
+// are read when img is not buffered.
+func GetPixel(img Image, x, y int) (color.RGBA64, error) {
+	d := img.Dims()
+	codec, err := pixelArgs(d, x, y)
+	if err != nil {
+		return color.RGBA64{}, err
+	}
+	if buffered, ok := img.(ImageBuffered); ok {
+		buf := buffered.Buffer()
+		if buf != nil {
+			return codec.Decode(buf[y*d.Stride:], x), nil
+		}
+	}
+	// Read from the first pixel that starts on a byte boundary.
+	bits := d.Shape.BitsPerPixel()
+	xg := x - x%d.Shape.pixelGroup()
+	var scratch [16]byte
+	buf := scratch[:((x-xg+1)*bits+7)/8]
+	n, err := img.ReadAt(buf, int64(y)*int64(d.Stride)+int64(xg*bits/8))
+	if n != len(buf) {
+		if err == nil {
+			err = errors.New("short read")
+		}
+		return color.RGBA64{}, err
+	}
+	return codec.Decode(buf, x-xg), nil
+}
+
+// SetPixel writes c to the pixel at (x,y) of img's buffer.
+func SetPixel(img ImageBuffered, x, y int, c color.RGBA64) error {
+	d := img.Dims()
+	codec, err := pixelArgs(d, x, y)
+	if err != nil {
+		return err
+	}
+	buf := img.Buffer()
+	if buf == nil {
+		return errors.New("nil image buffer")
+	}
+	codec.Encode(buf[y*d.Stride:], x, c)
+	return nil
+}
+
+func pixelArgs(d Dims, x, y int) (Codec, error) {
+	if err := d.Validate(); err != nil {
+		return Codec{}, err
+	}
+	codec, ok := d.Shape.Codec()
+	if !ok {
+		return Codec{}, errors.New("shape has no codec")
+	} else if x < 0 || y < 0 || x >= d.Width || y >= d.Height {
+		return Codec{}, errors.New("pixel out of bounds")
+	}
+	return codec, nil
+}
+
+// pixelGroup returns the amount of pixels after which pixel data is again aligned to a byte boundary.
+func (sh Shape) pixelGroup() int {
+	bits := sh.BitsPerPixel()
+	n := 1
+	for (n*bits)%8 != 0 {
+		n++
+	}
+	return n
+}
+
+func decodeRGB888(row []byte, x int) color.RGBA64 {
+	p := row[3*x : 3*x+3]
+	return color.RGBA64{R: uint16(p[0]) * 0x101, G: uint16(p[1]) * 0x101, B: uint16(p[2]) * 0x101, A: 0xffff}
+}
+
+func encodeRGB888(row []byte, x int, c color.RGBA64) {
+	p := row[3*x : 3*x+3]
+	p[0], p[1], p[2] = uint8(c.R>>8), uint8(c.G>>8), uint8(c.B>>8)
+}
+
+func decodeRGBA8888(row []byte, x int) color.RGBA64 {
+	p := row[4*x : 4*x+4]
+	return color.RGBA64{R: uint16(p[0]) * 0x101, G: uint16(p[1]) * 0x101, B: uint16(p[2]) * 0x101, A: uint16(p[3]) * 0x101}
+}
+
+func encodeRGBA8888(row []byte, x int, c color.RGBA64) {
+	p := row[4*x : 4*x+4]
+	p[0], p[1], p[2], p[3] = uint8(c.R>>8), uint8(c.G>>8), uint8(c.B>>8), uint8(c.A>>8)
+}
+
+func decodeNRGBA8888(row []byte, x int) color.RGBA64 {
+	p := row[4*x : 4*x+4]
+	a := uint32(p[3]) * 0x101
+	return color.RGBA64{
+		R: uint16(uint32(p[0]) * 0x101 * a / 0xffff),
+		G: uint16(uint32(p[1]) * 0x101 * a / 0xffff),
+		B: uint16(uint32(p[2]) * 0x101 * a / 0xffff),
+		A: uint16(a),
+	}
+}
+
+func encodeNRGBA8888(row []byte, x int, c color.RGBA64) {
+	p := row[4*x : 4*x+4]
+	switch c.A {
+	case 0xffff:
+		p[0], p[1], p[2], p[3] = uint8(c.R>>8), uint8(c.G>>8), uint8(c.B>>8), 0xff
+	case 0:
+		p[0], p[1], p[2], p[3] = 0, 0, 0, 0
+	default:
+		// Same as color.NRGBAModel.
+		a := uint32(c.A)
+		p[0] = uint8(uint32(c.R) * 0xffff / a >> 8)
+		p[1] = uint8(uint32(c.G) * 0xffff / a >> 8)
+		p[2] = uint8(uint32(c.B) * 0xffff / a >> 8)
+		p[3] = uint8(a >> 8)
+	}
+}
+
+func decodeGray8(row []byte, x int) color.RGBA64 {
+	y := uint16(row[x]) * 0x101
+	return opaque(y, y, y)
+}
+
+func encodeGray8(row []byte, x int, c color.RGBA64) {
+	row[x] = uint8(luma(c) >> 8)
+}
+
+func decodeGray16BE(row []byte, x int) color.RGBA64 {
+	y := uint16(row[2*x])<<8 | uint16(row[2*x+1])
+	return opaque(y, y, y)
+}
+
+func encodeGray16BE(row []byte, x int, c color.RGBA64) {
+	y := luma(c)
+	row[2*x], row[2*x+1] = uint8(y>>8), uint8(y)
+}
+
+func decodeRGB565BE(row []byte, x int) color.RGBA64 {
+	v := uint32(row[2*x])<<8 | uint32(row[2*x+1])
+	return opaque(expand(v>>11, 5), expand(v>>5&0x3f, 6), expand(v&0x1f, 5))
+}
+
+func encodeRGB565BE(row []byte, x int, c color.RGBA64) {
+	v := quantize(c.R, 5)<<11 | quantize(c.G, 6)<<5 | quantize(c.B, 5)
+	row[2*x], row[2*x+1] = uint8(v>>8), uint8(v)
+}
+
+func decodeRGB555(row []byte, x int) color.RGBA64 {
+	v := readBits(row, 15*x, 15)
+	return opaque(expand(v>>10, 5), expand(v>>5&0x1f, 5), expand(v&0x1f, 5))
+}
+
+func encodeRGB555(row []byte, x int, c color.RGBA64) {
+	writeBits(row, 15*x, 15, quantize(c.R, 5)<<10|quantize(c.G, 5)<<5|quantize(c.B, 5))
+}
+
+func decodeRGB444BE(row []byte, x int) color.RGBA64 {
+	v := readBits(row, 12*x, 12)
+	return opaque(expand(v>>8, 4), expand(v>>4&0xf, 4), expand(v&0xf, 4))
+}
+
+func encodeRGB444BE(row []byte, x int, c color.RGBA64) {
+	writeBits(row, 12*x, 12, quantize(c.R, 4)<<8|quantize(c.G, 4)<<4|quantize(c.B, 4))
+}
+
+func decodeGray2(row []byte, x int) color.RGBA64 {
+	y := expand(readBits(row, 2*x, 2), 2)
+	return opaque(y, y, y)
+}
+
+func encodeGray2(row []byte, x int, c color.RGBA64) {
+	writeBits(row, 2*x, 2, quantize(luma(c), 2))
+}
+
+func decodeMonochrome(row []byte, x int) color.RGBA64 {
+	y := expand(readBits(row, x, 1), 1)
+	return opaque(y, y, y)
+}
+
+func encodeMonochrome(row []byte, x int, c color.RGBA64) {
+	writeBits(row, x, 1, quantize(luma(c), 1))
+}
+
+func opaque(r, g, b uint16) color.RGBA64 {
+	return color.RGBA64{R: r, G: g, B: b, A: 0xffff}
+}
+
+// luma returns the luminance of c using the same weights as [color.GrayModel].
+func luma(c color.RGBA64) uint16 {
+	return uint16((19595*uint32(c.R) + 38470*uint32(c.G) + 7471*uint32(c.B) + 1<<15) >> 16)
+}
+
+// expand scales an n-bit value to 16 bits.
+func expand(v uint32, n uint) uint16 {
+	max := uint32(1)<<n - 1
+	return uint16((v*0xffff + max/2) / max)
+}
+
+// quantize scales a 16-bit value to n bits rounding to nearest.
+func quantize(c uint16, n uint) uint32 {
+	max := uint32(1)<<n - 1
+	return (uint32(c)*max + 0x7fff) / 0xffff
+}
+
+// readBits reads n<=24 bits starting at bit offset off counting from the MSB of row[0].
+func readBits(row []byte, off, n int) (v uint32) {
+	i := off / 8
+	avail := 8 - off%8
+	v = uint32(row[i]) & (1<<avail - 1)
+	for avail < n {
+		i++
+		v = v<<8 | uint32(row[i])
+		avail += 8
+	}
+	return v >> (avail - n)
+}
+
+// writeBits writes the n<=24 low bits of v starting at bit offset off counting from the MSB of row[0].
+func writeBits(row []byte, off, n int, v uint32) {
+	i := off / 8
+	shift := 8 - off%8 - n // Shift of v's LSB relative to LSB of row[i].
+	for n > 0 {
+		var part, mask uint32
+		if shift >= 0 {
+			part, mask = v<<shift, (1<<n-1)<<shift
+		} else {
+			part, mask = v>>-shift, (1<<n-1)>>-shift
+		}
+		row[i] = row[i]&^uint8(mask) | uint8(part&mask)
+		written := 8 - off%8
+		if written > n {
+			written = n
+		}
+		n -= written
+		v &= 1<<n - 1
+		off += written
+		i++
+		shift += 8
+	}
+}
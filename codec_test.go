@@ -0,0 +1,143 @@
+package pix
+
+import (
+	"bytes"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+var codecShapes = []Shape{
+	ShapeRGB888, ShapeRGBA8888, ShapeRGB565BE, ShapeRGB555,
+	ShapeRGB444BE, ShapeGrayscale2bit, ShapeMonochrome,
+	ShapeNRGBA8888, ShapeGrayscale8bit, ShapeGrayscale16BE,
+}
+
+// bufImage is a minimal in-memory image used for testing.
+type bufImage struct {
+	dims Dims
+	buf  []byte
+}
+
+func (b *bufImage) Dims() Dims     { return b.dims }
+func (b *bufImage) Buffer() []byte { return b.buf }
+func (b *bufImage) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(b.buf).ReadAt(p, off)
+}
+
+// readerImage hides the Buffer method of bufImage.
+type readerImage struct{ img *bufImage }
+
+func (r readerImage) Dims() Dims                              { return r.img.dims }
+func (r readerImage) ReadAt(p []byte, off int64) (int, error) { return r.img.ReadAt(p, off) }
+
+func newBufImage(width, height int, shape Shape) *bufImage {
+	d := Dims{Width: width, Height: height, Shape: shape}
+	d.Stride = d.SizeRow() + 1 // Padding to test stride handling.
+	return &bufImage{dims: d, buf: make([]byte, d.Size())}
+}
+
+// opaqueNRGBA sets alpha to 0xff since translucent non-premultiplied pixels are not
+// guaranteed to survive the round trip through [color.RGBA64], same as with [color.NRGBAModel].
+func opaqueNRGBA(img *bufImage) {
+	for y := 0; y < img.dims.Height; y++ {
+		for x := 0; x < img.dims.Width; x++ {
+			img.buf[y*img.dims.Stride+4*x+3] = 0xff
+		}
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, shape := range codecShapes {
+		codec, ok := shape.Codec()
+		if !ok {
+			t.Fatalf("%d: no codec", shape)
+		}
+		const width, height = 13, 3
+		img := newBufImage(width, height, shape)
+		rng.Read(img.buf)
+		if shape == ShapeNRGBA8888 {
+			opaqueNRGBA(img)
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				want, err := GetPixel(img, x, y)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Re-encoding a decoded pixel must not change the image.
+				before := bytes.Clone(img.buf)
+				err = SetPixel(img, x, y, want)
+				if err != nil {
+					t.Fatal(err)
+				} else if !bytes.Equal(before, img.buf) {
+					t.Fatalf("shape %d: re-encoding pixel (%d,%d) modified buffer", shape, x, y)
+				}
+				got, err := GetPixel(readerImage{img}, x, y)
+				if err != nil {
+					t.Fatal(err)
+				} else if got != want {
+					t.Errorf("shape %d: ReadAt pixel (%d,%d) got %v, want %v", shape, x, y, got, want)
+				}
+				if got := codec.Decode(img.buf[y*img.dims.Stride:], x); got != want {
+					t.Errorf("shape %d: codec pixel (%d,%d) got %v, want %v", shape, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCodecExtremes(t *testing.T) {
+	white := color.RGBA64{R: 0xffff, G: 0xffff, B: 0xffff, A: 0xffff}
+	black := color.RGBA64{A: 0xffff}
+	for _, shape := range codecShapes {
+		img := newBufImage(5, 1, shape)
+		for x := 0; x < 5; x++ {
+			c := white
+			if x%2 == 1 {
+				c = black
+			}
+			if err := SetPixel(img, x, 0, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for x := 0; x < 5; x++ {
+			want := white
+			if x%2 == 1 {
+				want = black
+			}
+			got, _ := GetPixel(img, x, 0)
+			if got != want {
+				t.Errorf("shape %d: pixel %d got %v, want %v", shape, x, got, want)
+			}
+		}
+	}
+}
+
+func TestCodecBitOrder(t *testing.T) {
+	red := color.RGBA64{R: 0xffff, A: 0xffff}
+	white := color.RGBA64{R: 0xffff, G: 0xffff, B: 0xffff, A: 0xffff}
+	tests := []struct {
+		shape Shape
+		x     int
+		c     color.RGBA64
+		want  []byte
+	}{
+		{shape: ShapeRGB565BE, x: 0, c: red, want: []byte{0xf8, 0x00}},
+		{shape: ShapeRGB444BE, x: 0, c: red, want: []byte{0xf0, 0x00, 0x00}},
+		{shape: ShapeRGB444BE, x: 1, c: red, want: []byte{0x00, 0x0f, 0x00}},
+		{shape: ShapeRGB555, x: 0, c: red, want: []byte{0xf8, 0x00}},
+		{shape: ShapeRGB555, x: 1, c: red, want: []byte{0x00, 0x01, 0xf0, 0x00}},
+		{shape: ShapeGrayscale2bit, x: 1, c: white, want: []byte{0x30}},
+		{shape: ShapeMonochrome, x: 9, c: white, want: []byte{0x00, 0x40}},
+	}
+	for _, test := range tests {
+		codec, _ := test.shape.Codec()
+		row := make([]byte, len(test.want))
+		codec.Encode(row, test.x, test.c)
+		if !bytes.Equal(row, test.want) {
+			t.Errorf("shape %d pixel %d: got %#x, want %#x", test.shape, test.x, row, test.want)
+		}
+	}
+}
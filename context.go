@@ -0,0 +1,36 @@
+package pix
+
+import (
+	"context"
+	"image"
+)
+
+// ProgressFunc reports processing progress as the number of output rows done out of
+// rowsTotal. Calls are serialized even if rows are processed concurrently.
+type ProgressFunc func(rowsDone, rowsTotal int)
+
+// ContextFilter is implemented by filters whose processing can be cancelled and that report progress.
+type ContextFilter interface {
+	Filter
+	// ProcessContext processes an input image like [Filter.Process]. ctx is checked
+	// between rows or bands of rows and if done processing stops and ctx.Err() is returned,
+	// in which case the destination may be partially written.
+	// progress is optional and may be nil.
+	ProcessContext(ctx context.Context, dst []byte, src Image, roi *image.Rectangle, progress ProgressFunc) (Dims, error)
+}
+
+// ProcessContext processes src with f calling [ContextFilter.ProcessContext] if f implements it.
+// Otherwise ctx is only checked before processing and progress is reported once processing is done.
+func ProcessContext(ctx context.Context, f Filter, dst []byte, src Image, roi *image.Rectangle, progress ProgressFunc) (Dims, error) {
+	if cf, ok := f.(ContextFilter); ok {
+		return cf.ProcessContext(ctx, dst, src, roi, progress)
+	}
+	if err := ctx.Err(); err != nil {
+		return Dims{}, err
+	}
+	dims, err := f.Process(dst, src, roi)
+	if err == nil && progress != nil {
+		progress(dims.Height, dims.Height)
+	}
+	return dims, err
+}
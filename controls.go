@@ -3,6 +3,7 @@ package pix
 import (
 	"cmp"
 	"fmt"
+	"image/color"
 	"slices"
 
 	"github.com/soypat/geometry/ms2"
@@ -120,3 +121,33 @@ func (cc *ControlCurve) ChangeValue(newValue any) error {
 	}
 	return err
 }
+
+// ControlColor maps to a color picker. ChangeValue accepts any [color.Color]
+// which is converted to alpha-premultiplied [color.RGBA64].
+type ControlColor struct {
+	Name        string
+	Description string
+	Value       color.RGBA64
+	OnChange    func(color.RGBA64) error
+}
+
+func (cc *ControlColor) Describe() (name, description string) {
+	return cc.Name, cc.Description
+}
+
+func (cc *ControlColor) ActualValue() any {
+	return cc.Value
+}
+
+func (cc *ControlColor) ChangeValue(newValue any) error {
+	c, ok := newValue.(color.Color)
+	if !ok {
+		return fmt.Errorf("new value %T not of type color.Color", newValue)
+	}
+	v := color.RGBA64Model.Convert(c).(color.RGBA64)
+	err := cc.OnChange(v)
+	if err == nil {
+		cc.Value = v
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package filters
+
+import (
+	"errors"
+	"math"
+
+	"github.com/soypat/pix"
+)
+
+// gaussianKernel returns a normalized gaussian kernel with standard deviation sigma
+// truncated at 3 standard deviations. Returns the identity kernel for sigma<=0.
+func gaussianKernel(sigma float32) []float32 {
+	if sigma <= 0 {
+		return []float32{1}
+	}
+	radius := int(math.Ceil(3 * float64(sigma)))
+	kernel := make([]float32, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		x := float64(i - radius)
+		w := math.Exp(-x * x / (2 * float64(sigma) * float64(sigma)))
+		kernel[i] = float32(w)
+		sum += w
+	}
+	for i := range kernel {
+		kernel[i] = float32(float64(kernel[i]) / sum)
+	}
+	return kernel
+}
+
+// NewGaussianBlur creates a separable gaussian blur filter. radius is the standard deviation (sigma)
+// of the gaussian in pixels, neighbors up to 3 times radius away are sampled. Border defaults to [BorderMirror].
+// The "Radius" control sets the same standard deviation, like the radius of [NewUnsharpMask].
+// Supported shapes are RGB888, RGBA8888, Grayscale2bit, Grayscale8bit and Grayscale16BE.
+func NewGaussianBlur(shape pix.Shape, radius float32) (*NeighborhoodFilter, error) {
+	if radius < 0 {
+		return nil, errors.New("negative blur radius")
+	}
+	kernel := gaussianKernel(radius)
+	k := &separableKernel{x: kernel, y: kernel}
+	fn, err := k.fn(shape)
+	if err != nil {
+		return nil, err
+	}
+	f := &NeighborhoodFilter{
+		In:     shape,
+		Out:    shape,
+		Radius: k.radius(),
+		Border: BorderMirror,
+		Fn:     fn,
+	}
+	f.Ctrls = []pix.Control{
+		&pix.ControlOrdered[float32]{
+			Name:        "Radius",
+			Description: "Standard deviation (sigma) of the gaussian in pixels",
+			Value:       radius,
+			Min:         0,
+			Max:         100,
+			Step:        0.1,
+			OnChange: func(v float32) error {
+				kernel := gaussianKernel(v)
+				k.x, k.y = kernel, kernel
+				f.Radius = k.radius()
+				return nil
+			},
+		},
+	}
+	return f, nil
+}
+
+// boxSums holds the vertical sums of every padded window column of a band.
+type boxSums []int64
+
+// NewBoxBlur creates a filter which averages the (2*radius+1)x(2*radius+1) neighborhood of each pixel.
+// Column sums are updated as the window slides down and rows are averaged with a running sum, so the
+// cost per pixel does not depend on radius. Sums are exact integers. Border defaults to [BorderMirror].
+// Supported shapes are those of [NewGaussianBlur].
+func NewBoxBlur(shape pix.Shape, radius int) (*NeighborhoodFilter, error) {
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if radius < 0 {
+		return nil, errors.New("negative blur radius")
+	}
+	f := &NeighborhoodFilter{
+		In:  shape,
+		Out: shape,
+		// The window holds one extra row above to subtract it from the column sums.
+		Radius: radius + 1,
+		Border: BorderMirror,
+		Fn: func(dst []byte, win *Window) {
+			r := win.Radius - 1
+			n := (win.Width + 2*win.Radius) * channels
+			sums, _ := win.State.(boxSums)
+			if sums == nil {
+				sums = make(boxSums, n)
+				for dy := -r; dy <= r; dy++ {
+					row := win.Row(dy)
+					for i := range sums {
+						sums[i] += int64(loadSample(row, i, bpc))
+					}
+				}
+				win.State = sums
+			} else {
+				add, sub := win.Row(r), win.Row(-r-1)
+				for i := range sums {
+					sums[i] += int64(loadSample(add, i, bpc) - loadSample(sub, i, bpc))
+				}
+			}
+			side := int64(2*r + 1)
+			area := side * side
+			for c := 0; c < channels; c++ {
+				// Output pixel x averages padded columns x+1 to x+2*r+1.
+				var acc int64
+				for j := 1; j <= 2*r+1; j++ {
+					acc += sums[j*channels+c]
+				}
+				for x := 0; x < win.Width; x++ {
+					storeSample(dst, x*channels+c, bpc, int32((acc+area/2)/area))
+					acc += sums[(x+2*r+2)*channels+c] - sums[(x+1)*channels+c]
+				}
+			}
+		},
+	}
+	f.Ctrls = []pix.Control{
+		&pix.ControlOrdered[int]{
+			Name:        "Radius",
+			Description: "Number of neighbor pixels averaged on each side",
+			Value:       radius,
+			Min:         0,
+			Max:         255,
+			Step:        1,
+			OnChange: func(v int) error {
+				f.Radius = v + 1
+				return nil
+			},
+		},
+	}
+	return f, nil
+}
@@ -0,0 +1,58 @@
+package filters
+
+import (
+	"errors"
+
+	"github.com/soypat/pix"
+)
+
+// NewConvert creates a filter that converts pixels from the in shape to the out shape.
+// Any pair of shapes with a [pix.Codec] is supported, including sub-byte shapes.
+// Reducing bit depth rounds to the nearest representable value, see [NewDither] for dithered conversion.
+func NewConvert(out, in pix.Shape) (*PointFilter, error) {
+	inCodec, ok := in.Codec()
+	if !ok {
+		return nil, errors.New("unsupported input shape")
+	}
+	outCodec, ok := out.Codec()
+	if !ok {
+		return nil, errors.New("unsupported output shape")
+	}
+	var fn PointFunc
+	switch {
+	case in == out:
+		fn = func(dst, src []byte) { copy(dst, src) }
+	case in == pix.ShapeRGB888 && out == pix.ShapeRGB565BE:
+		fn = convertRGB888ToRGB565BE
+	default:
+		inBits, outBits := in.BitsPerPixel(), out.BitsPerPixel()
+		fn = func(dst, src []byte) {
+			n := min(len(src)*8/inBits, len(dst)*8/outBits)
+			for x := 0; x < n; x++ {
+				outCodec.Encode(dst, x, inCodec.Decode(src, x))
+			}
+		}
+	}
+	return &PointFilter{
+		In:  in,
+		Out: out,
+		Fn:  fn,
+	}, nil
+}
+
+// Lookup tables matching the rounding of the RGB565BE codec for 8-bit channels.
+var lut5, lut6 = func() (l5, l6 [256]uint16) {
+	for v := range 256 {
+		l5[v] = uint16((v*31 + 127) / 255)
+		l6[v] = uint16((v*63 + 127) / 255)
+	}
+	return l5, l6
+}()
+
+func convertRGB888ToRGB565BE(dst, src []byte) {
+	n := min(len(src)/3, len(dst)/2)
+	for i := 0; i < n; i++ {
+		v := lut5[src[3*i]]<<11 | lut6[src[3*i+1]]<<5 | lut5[src[3*i+2]]
+		dst[2*i], dst[2*i+1] = uint8(v>>8), uint8(v)
+	}
+}
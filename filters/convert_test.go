@@ -0,0 +1,95 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+var allShapes = []pix.Shape{
+	pix.ShapeRGB888, pix.ShapeRGBA8888, pix.ShapeRGB565BE, pix.ShapeRGB555,
+	pix.ShapeRGB444BE, pix.ShapeGrayscale2bit, pix.ShapeMonochrome,
+	pix.ShapeNRGBA8888, pix.ShapeGrayscale8bit, pix.ShapeGrayscale16BE,
+}
+
+// testImage is a minimal in-memory image used for testing.
+type testImage struct {
+	dims pix.Dims
+	buf  []byte
+}
+
+func (ti *testImage) Dims() pix.Dims { return ti.dims }
+func (ti *testImage) Buffer() []byte { return ti.buf }
+func (ti *testImage) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(ti.buf).ReadAt(p, off)
+}
+
+// readerImage hides the Buffer method of testImage to exercise ReadAt code paths.
+type readerImage struct{ img *testImage }
+
+func (r readerImage) Dims() pix.Dims                          { return r.img.dims }
+func (r readerImage) ReadAt(p []byte, off int64) (int, error) { return r.img.ReadAt(p, off) }
+
+func newRand() *rand.Rand { return rand.New(rand.NewSource(1)) }
+
+func newRandomImage(rng *rand.Rand, width, height int, shape pix.Shape) *testImage {
+	d := pix.Dims{Width: width, Height: height, Shape: shape}
+	d.Stride = d.SizeRow() + 3
+	img := &testImage{dims: d, buf: make([]byte, d.Size())}
+	rng.Read(img.buf)
+	if shape == pix.ShapeNRGBA8888 {
+		// Translucent non-premultiplied pixels do not survive conversion to color.RGBA64 exactly.
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.buf[y*d.Stride+4*x+3] = 0xff
+			}
+		}
+	}
+	return img
+}
+
+func TestConvertAllShapes(t *testing.T) {
+	rng := newRand()
+	const width, height = 19, 5
+	rois := []*image.Rectangle{nil, {Min: image.Pt(3, 1), Max: image.Pt(17, 4)}}
+	for _, in := range allShapes {
+		src := newRandomImage(rng, width, height, in)
+		for _, out := range allShapes {
+			filter, err := NewConvert(out, in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outCodec, _ := out.Codec()
+			for _, roi := range rois {
+				r := image.Rect(0, 0, width, height)
+				if roi != nil {
+					r = *roi
+				}
+				dst := make([]byte, 1024)
+				for _, img := range []pix.Image{src, readerImage{src}} {
+					dims, err := filter.Process(dst, img, roi)
+					if err != nil {
+						t.Fatal(err)
+					} else if dims.Stride != dims.SizeRow() || dims.Width != r.Dx() || dims.Height != r.Dy() || dims.Shape != out {
+						t.Fatalf("%d->%d: bad output dims %+v", in, out, dims)
+					}
+					for y := 0; y < dims.Height; y++ {
+						for x := 0; x < dims.Width; x++ {
+							c, _ := pix.GetPixel(src, x+r.Min.X, y+r.Min.Y)
+							want := make([]byte, 4)
+							outCodec.Encode(want, 0, c)
+							wantc := outCodec.Decode(want, 0)
+							got := outCodec.Decode(dst[y*dims.Stride:], x)
+							if got != wantc {
+								t.Fatalf("%d->%d roi=%v: pixel (%d,%d) got %v, want %v", in, out, roi, x, y, got, wantc)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
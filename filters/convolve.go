@@ -0,0 +1,196 @@
+package filters
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/soypat/pix"
+)
+
+// kernelLayout returns the number of channels and bytes per channel of shapes supported by kernel filters.
+// Grayscale2bit is unpacked to Grayscale8bit by [NeighborhoodFilter] so it shares its layout.
+func kernelLayout(shape pix.Shape) (channels, bytesPerChannel int, err error) {
+	switch shape {
+	case pix.ShapeGrayscale8bit, pix.ShapeGrayscale2bit:
+		return 1, 1, nil
+	case pix.ShapeGrayscale16BE:
+		return 1, 2, nil
+	case pix.ShapeRGB888:
+		return 3, 1, nil
+	case pix.ShapeRGBA8888:
+		return 4, 1, nil
+	}
+	return 0, 0, errors.New("kernel filters support RGB888, RGBA8888, Grayscale2bit, Grayscale8bit and Grayscale16BE shapes")
+}
+
+// loadSample returns channel sample i of row.
+func loadSample(row []byte, i, bpc int) int32 {
+	if bpc == 2 {
+		return int32(row[2*i])<<8 | int32(row[2*i+1])
+	}
+	return int32(row[i])
+}
+
+// storeSample sets channel sample i of row to v which must be representable.
+func storeSample(row []byte, i, bpc int, v int32) {
+	if bpc == 2 {
+		row[2*i] = byte(v >> 8)
+		row[2*i+1] = byte(v)
+		return
+	}
+	row[i] = byte(v)
+}
+
+// storePixel rounds and clamps the channels of pixel x to the sample range.
+// Color channels of 4 channel shapes are clamped to alpha to remain valid premultiplied colors.
+func storePixel(row []byte, x int, px []float32, bpc int) {
+	maxv := float32(int32(1)<<(8*bpc) - 1)
+	var alpha int32 = math.MaxInt32
+	if len(px) == 4 {
+		alpha = int32(max(0, min(px[3], maxv)) + 0.5)
+	}
+	for c, v := range px {
+		q := int32(max(0, min(v, maxv)) + 0.5)
+		if c < 3 {
+			q = min(q, alpha)
+		}
+		storeSample(row, x*len(px)+c, bpc, q)
+	}
+}
+
+// NewConvolve creates a filter that computes the weighted sum of the neighbors of every pixel.
+// kernel is a square matrix of odd size stored in row-major order whose element at
+// row dy+radius and column dx+radius weights the neighbor at offset (dx,dy), so the kernel is not flipped.
+// Sums are accumulated in float32 and clamped to the sample range.
+func NewConvolve(shape pix.Shape, kernel []float32, border BorderMode) (*NeighborhoodFilter, error) {
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return nil, err
+	}
+	size := int(math.Sqrt(float64(len(kernel))))
+	if size*size != len(kernel) || size%2 == 0 {
+		return nil, errors.New("convolution kernel must be a square matrix of odd size")
+	}
+	radius := size / 2
+	kernel = append([]float32(nil), kernel...)
+	return &NeighborhoodFilter{
+		In:     shape,
+		Out:    shape,
+		Radius: radius,
+		Border: border,
+		Fn: func(dst []byte, win *Window) {
+			var px [4]float32
+			for x := 0; x < win.Width; x++ {
+				clear(px[:])
+				for dy := -radius; dy <= radius; dy++ {
+					row := win.Row(dy)
+					weights := kernel[(dy+radius)*size:]
+					for dx := -radius; dx <= radius; dx++ {
+						w := weights[dx+radius]
+						i := (x + dx + radius) * channels
+						for c := 0; c < channels; c++ {
+							px[c] += w * float32(loadSample(row, i+c, bpc))
+						}
+					}
+				}
+				storePixel(dst, x, px[:channels], bpc)
+			}
+		},
+	}, nil
+}
+
+// NewSeparableConvolve creates a filter equivalent to [NewConvolve] with the outer product of ky and kx
+// as kernel. kx is applied horizontally and ky vertically. Both must have odd length but may differ in length.
+// The cost per pixel is proportional to len(kx)+len(ky) instead of their product.
+func NewSeparableConvolve(shape pix.Shape, kx, ky []float32, border BorderMode) (*NeighborhoodFilter, error) {
+	if len(kx)%2 == 0 || len(ky)%2 == 0 {
+		return nil, errors.New("separable kernels must have odd length")
+	}
+	k := &separableKernel{x: append([]float32(nil), kx...), y: append([]float32(nil), ky...)}
+	fn, err := k.fn(shape)
+	if err != nil {
+		return nil, err
+	}
+	return &NeighborhoodFilter{
+		In:     shape,
+		Out:    shape,
+		Radius: k.radius(),
+		Border: border,
+		Fn:     fn,
+	}, nil
+}
+
+// separableKernel holds odd length horizontal and vertical kernels.
+// Kernels may be replaced between calls to Process by controls.
+type separableKernel struct {
+	x, y []float32
+}
+
+func (k *separableKernel) radius() int {
+	return max(len(k.x), len(k.y)) / 2
+}
+
+// fn returns a function which filters the window with the kernels.
+func (k *separableKernel) fn(shape pix.Shape) (NeighborhoodFunc, error) {
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return nil, err
+	}
+	// Scratch rows are pooled so the function may be called concurrently.
+	var pool sync.Pool
+	return func(dst []byte, win *Window) {
+		s := getKernelScratch(&pool)
+		out := k.filterRow(s, win, channels, bpc)
+		for x := 0; x < win.Width; x++ {
+			storePixel(dst, x, out[x*channels:(x+1)*channels], bpc)
+		}
+		pool.Put(s)
+	}, nil
+}
+
+// kernelScratch holds float32 rows used while filtering a window.
+type kernelScratch struct {
+	tmp, out []float32
+}
+
+func getKernelScratch(pool *sync.Pool) *kernelScratch {
+	s, _ := pool.Get().(*kernelScratch)
+	if s == nil {
+		s = new(kernelScratch)
+	}
+	return s
+}
+
+// filterRow applies the vertical kernel to the window columns and then the
+// horizontal kernel to the result. Returns the filtered channel samples of the output row.
+func (k *separableKernel) filterRow(s *kernelScratch, win *Window, channels, bpc int) []float32 {
+	kx, ky := k.x, k.y
+	rx, ry := len(kx)/2, len(ky)/2
+	n := (win.Width + 2*rx) * channels
+	s.tmp = slices.Grow(s.tmp[:0], n)[:n]
+	s.out = slices.Grow(s.out[:0], win.Width*channels)[:win.Width*channels]
+	tmp, out := s.tmp, s.out
+	clear(tmp)
+	// Vertical pass over the columns needed by the horizontal pass.
+	first := (win.Radius - rx) * channels
+	for j, w := range ky {
+		row := win.Row(j - ry)
+		for i := range tmp {
+			tmp[i] += w * float32(loadSample(row, first+i, bpc))
+		}
+	}
+	// Horizontal pass.
+	clear(out)
+	for x := 0; x < win.Width; x++ {
+		px := out[x*channels : (x+1)*channels]
+		for j, w := range kx {
+			col := tmp[(x+j)*channels:]
+			for c := range px {
+				px[c] += w * col[c]
+			}
+		}
+	}
+	return out
+}
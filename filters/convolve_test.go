@@ -0,0 +1,237 @@
+package filters
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+var kernelShapes = []pix.Shape{pix.ShapeGrayscale8bit, pix.ShapeGrayscale16BE, pix.ShapeRGB888, pix.ShapeRGBA8888}
+
+// maxDiff returns the largest absolute difference between bytes of a and b.
+func maxDiff(a, b []byte) int {
+	var d int
+	for i := range a {
+		d = max(d, int(a[i])-int(b[i]), int(b[i])-int(a[i]))
+	}
+	return d
+}
+
+// processFilter processes src with f into a buffer sized with [pix.OutputDims].
+func processFilter(t testing.TB, f pix.Filter, src pix.Image, roi *image.Rectangle) []byte {
+	t.Helper()
+	d, err := pix.OutputDims(f, src.Dims(), roi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]byte, d.Size())
+	dims, err := f.Process(dst, src, roi)
+	if err != nil {
+		t.Fatal(err)
+	} else if dims != d {
+		t.Fatalf("got dims %+v, want %+v", dims, d)
+	}
+	return dst
+}
+
+// premultiply makes RGBA8888 test images valid premultiplied colors.
+func premultiply(img *testImage) {
+	if img.dims.Shape != pix.ShapeRGBA8888 {
+		return
+	}
+	for y := 0; y < img.dims.Height; y++ {
+		row := img.buf[y*img.dims.Stride:]
+		for i := 0; i < 4*img.dims.Width; i += 4 {
+			a := row[i+3]
+			row[i], row[i+1], row[i+2] = min(row[i], a), min(row[i+1], a), min(row[i+2], a)
+		}
+	}
+}
+
+func TestConvolveIdentity(t *testing.T) {
+	for _, shape := range kernelShapes {
+		img := newRandomImage(newRand(), 11, 7, shape)
+		premultiply(img)
+		f, err := NewConvolve(shape, []float32{0, 0, 0, 0, 1, 0, 0, 0, 0}, BorderClamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rect := image.Rect(2, 1, 10, 6)
+		got := processFilter(t, f, img, &rect)
+		want := processFilter(t, &PointFilter{In: shape, Out: shape, Fn: func(dst, src []byte) { copy(dst, src) }}, img, &rect)
+		if !bytes.Equal(got, want) {
+			t.Errorf("shape %d: identity kernel modified image", shape)
+		}
+	}
+}
+
+func TestSeparableConvolve(t *testing.T) {
+	kx := []float32{0.25, 0.5, 0.25}
+	ky := []float32{0.1, 0.2, 0.4, 0.2, 0.1}
+	kernel := make([]float32, 25)
+	for i, wy := range ky {
+		for j := range 5 {
+			if j > 0 && j < 4 {
+				kernel[i*5+j] = wy * kx[j-1]
+			}
+		}
+	}
+	for _, shape := range kernelShapes {
+		img := newRandomImage(newRand(), 16, 9, shape)
+		premultiply(img)
+		full, err := NewConvolve(shape, kernel, BorderMirror)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sep, err := NewSeparableConvolve(shape, kx, ky, BorderMirror)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sep.Workers = 2
+		want := processFilter(t, full, img, nil)
+		got := processFilter(t, sep, readerImage{img}, nil)
+		if d := maxDiff(got, want); d > 1 {
+			t.Errorf("shape %d: separable differs from 2D convolution by %d", shape, d)
+		}
+	}
+}
+
+func TestBoxBlur(t *testing.T) {
+	for _, shape := range kernelShapes {
+		for _, radius := range []int{0, 1, 4} {
+			img := newRandomImage(newRand(), 17, 13, shape)
+			premultiply(img)
+			side := 2*radius + 1
+			kernel := make([]float32, side*side)
+			for i := range kernel {
+				kernel[i] = 1 / float32(len(kernel))
+			}
+			ref, err := NewConvolve(shape, kernel, BorderMirror)
+			if err != nil {
+				t.Fatal(err)
+			}
+			box, err := NewBoxBlur(shape, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = box.Controls()[0].ChangeValue(radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			box.Workers = 3
+			rect := image.Rect(1, 2, 15, 13)
+			want := processFilter(t, ref, img, &rect)
+			got := processFilter(t, box, img, &rect)
+			if d := maxDiff(got, want); d > 1 {
+				t.Errorf("shape %d radius %d: box blur differs from convolution by %d", shape, radius, d)
+			}
+		}
+	}
+}
+
+func TestGaussianBlurUniform(t *testing.T) {
+	const width, height = 20, 10
+	img := &testImage{
+		dims: pix.Dims{Width: width, Height: height, Stride: 2 * width, Shape: pix.ShapeGrayscale16BE},
+		buf:  bytes.Repeat([]byte{0x9a, 0xbc}, width*height),
+	}
+	f, err := NewGaussianBlur(pix.ShapeGrayscale16BE, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Controls()[0].ChangeValue(float32(2.5))
+	if err != nil {
+		t.Fatal(err)
+	} else if f.Radius != 8 {
+		t.Errorf("sigma 2.5: window radius got %d, want 8", f.Radius)
+	}
+	_, err = f.Process(nil, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(img.buf); i += 2 {
+		if img.buf[i] != 0x9a || img.buf[i+1] != 0xbc {
+			t.Fatalf("uniform image changed at byte %d: %x%x", i, img.buf[i], img.buf[i+1])
+		}
+	}
+}
+
+func TestBlurGrayscale2bit(t *testing.T) {
+	const width, height = 13, 9
+	img := newRandomImage(newRand(), width, height, pix.ShapeGrayscale2bit)
+	roi := image.Rect(3, 1, 12, 8)
+	to8, err := NewConvert(pix.ShapeGrayscale8bit, pix.ShapeGrayscale2bit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to2, err := NewConvert(pix.ShapeGrayscale2bit, pix.ShapeGrayscale8bit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray8 := &testImage{
+		dims: pix.Dims{Width: width, Height: height, Stride: width, Shape: pix.ShapeGrayscale8bit},
+		buf:  processFilter(t, to8, img, nil),
+	}
+	blurs := map[string]func(pix.Shape) (*NeighborhoodFilter, error){
+		"gaussian": func(sh pix.Shape) (*NeighborhoodFilter, error) { return NewGaussianBlur(sh, 1.5) },
+		"box":      func(sh pix.Shape) (*NeighborhoodFilter, error) { return NewBoxBlur(sh, 2) },
+	}
+	for name, newBlur := range blurs {
+		f2, err := newBlur(pix.ShapeGrayscale2bit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f8, err := newBlur(pix.ShapeGrayscale8bit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Blurring 2-bit pixels must match blurring them unpacked to 8 bits and quantizing the result.
+		blurred := &testImage{
+			dims: pix.Dims{Width: roi.Dx(), Height: roi.Dy(), Stride: roi.Dx(), Shape: pix.ShapeGrayscale8bit},
+			buf:  processFilter(t, f8, gray8, &roi),
+		}
+		want := processFilter(t, to2, blurred, nil)
+		got := processFilter(t, f2, img, &roi)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: 2-bit blur differs from 8-bit blur quantized to 2 bits", name)
+		}
+
+		inPlace := &testImage{dims: img.dims, buf: bytes.Clone(img.buf)}
+		if _, err = f2.Process(nil, inPlace, &roi); err != nil {
+			t.Fatal(err)
+		}
+		outDims := pix.Dims{Width: roi.Dx(), Height: roi.Dy(), Shape: pix.ShapeGrayscale2bit}
+		outDims.Stride = outDims.SizeRow()
+		out := &testImage{dims: outDims, buf: got}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				want, _ := pix.GetPixel(img, x, y)
+				if p := image.Pt(x, y); p.In(roi) {
+					want, _ = pix.GetPixel(out, x-roi.Min.X, y-roi.Min.Y)
+				}
+				if c, _ := pix.GetPixel(inPlace, x, y); c != want {
+					t.Fatalf("%s: in-place pixel (%d,%d) got %v, want %v", name, x, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkBoxBlur(b *testing.B) {
+	img := newRandomImage(newRand(), 640, 480, pix.ShapeRGB888)
+	for _, radius := range []int{1, 16} {
+		f, err := NewBoxBlur(pix.ShapeRGB888, radius)
+		if err != nil {
+			b.Fatal(err)
+		}
+		dst := make([]byte, img.dims.Size())
+		b.Run(fmt.Sprintf("radius=%d", radius), func(b *testing.B) {
+			for b.Loop() {
+				f.Process(dst, img, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package filters
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/soypat/pix"
+)
+
+// Parameter limits of the denoising filters shared by constructors and controls.
+const (
+	minBilateralSpatial, maxBilateralSpatial = 0.1, 20
+	minBilateralRange, maxBilateralRange     = 1, 255
+	maxNLMPatchRadius, maxNLMSearchRadius    = 5, 20
+	minNLMStrength, maxNLMStrength           = 1, 100
+)
+
+// bilateral holds the weight tables of a bilateral filter which are rebuilt when controls change.
+type bilateral struct {
+	f              *NeighborhoodFilter
+	sigmaS, sigmaR float32
+	spatial        []float32 // Weights of the (2*radius+1)^2 neighbors in row-major order.
+	rangeW         [256]float32
+	shift          uint // Converts sample differences to 8-bit levels.
+}
+
+func (b *bilateral) update() {
+	radius := int(math.Ceil(2 * float64(b.sigmaS)))
+	side := 2*radius + 1
+	b.spatial = make([]float32, side*side)
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			d2 := float64(dx*dx + dy*dy)
+			b.spatial[(dy+radius)*side+dx+radius] = float32(math.Exp(-d2 / (2 * float64(b.sigmaS) * float64(b.sigmaS))))
+		}
+	}
+	for d := range b.rangeW {
+		b.rangeW[d] = float32(math.Exp(-float64(d*d) / (2 * float64(b.sigmaR) * float64(b.sigmaR))))
+	}
+	b.f.Radius = radius
+}
+
+// NewBilateral creates an edge preserving bilateral smoothing filter. Each pixel is replaced with the average
+// of its neighbors weighted by a gaussian of their distance with standard deviation spatialSigma, in pixels,
+// and a gaussian of their difference in value with standard deviation rangeSigma, in 8-bit levels.
+// Neighbors across edges differ strongly in value and barely contribute so edges remain sharp.
+// Neighbors up to 2*spatialSigma pixels away are sampled and the value difference weight is the product of the
+// weights of the differences of each channel. spatialSigma must be within 0.1..20 and rangeSigma within 1..255.
+//
+// Supported shapes are those of [NewConvolve]. Workers defaults to GOMAXPROCS.
+func NewBilateral(shape pix.Shape, spatialSigma, rangeSigma float32) (*NeighborhoodFilter, error) {
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if spatialSigma < minBilateralSpatial || spatialSigma > maxBilateralSpatial {
+		return nil, errors.New("bilateral spatial sigma out of range 0.1..20")
+	} else if rangeSigma < minBilateralRange || rangeSigma > maxBilateralRange {
+		return nil, errors.New("bilateral range sigma out of range 1..255")
+	}
+	b := &bilateral{sigmaS: spatialSigma, sigmaR: rangeSigma, shift: uint(8 * (bpc - 1))}
+	b.f = &NeighborhoodFilter{
+		In:      shape,
+		Out:     shape,
+		Border:  BorderMirror,
+		Workers: runtime.GOMAXPROCS(0),
+		Fn: func(dst []byte, win *Window) {
+			radius := win.Radius
+			side := 2*radius + 1
+			center := win.Row(0)
+			var acc, px [4]float32
+			for x := 0; x < win.Width; x++ {
+				ci := (x + radius) * channels
+				clear(acc[:])
+				var wsum float32
+				for dy := -radius; dy <= radius; dy++ {
+					row := win.Row(dy)
+					spatial := b.spatial[(dy+radius)*side:][:side]
+					for j, w := range spatial {
+						i := (x + j) * channels
+						for c := 0; c < channels; c++ {
+							v := loadSample(row, i+c, bpc)
+							d := v - loadSample(center, ci+c, bpc)
+							w *= b.rangeW[min(max(d, -d)>>b.shift, 255)]
+							px[c] = float32(v)
+						}
+						for c := 0; c < channels; c++ {
+							acc[c] += w * px[c]
+						}
+						wsum += w
+					}
+				}
+				for c := 0; c < channels; c++ {
+					px[c] = acc[c] / wsum
+				}
+				storePixel(dst, x, px[:channels], bpc)
+			}
+		},
+	}
+	b.update()
+	b.f.Ctrls = []pix.Control{
+		&pix.ControlOrdered[float32]{
+			Name:        "Spatial Sigma",
+			Description: "Standard deviation in pixels of the distance weight",
+			Value:       spatialSigma,
+			Min:         minBilateralSpatial,
+			Max:         maxBilateralSpatial,
+			Step:        0.1,
+			OnChange: func(v float32) error {
+				b.sigmaS = v
+				b.update()
+				return nil
+			},
+		},
+		&pix.ControlOrdered[float32]{
+			Name:        "Range Sigma",
+			Description: "Standard deviation in 8-bit levels of the value difference weight. Larger values smooth stronger edges",
+			Value:       rangeSigma,
+			Min:         minBilateralRange,
+			Max:         maxBilateralRange,
+			Step:        1,
+			OnChange: func(v float32) error {
+				b.sigmaR = v
+				b.update()
+				return nil
+			},
+		},
+	}
+	return b.f, nil
+}
+
+// NewNonLocalMeans creates a non-local means denoising filter. Each pixel is replaced with the average of
+// the pixels within searchRadius whose surrounding (2*patchRadius+1)^2 patch resembles the pixel's patch.
+// Pixels are weighted by exp(-d/strength²) where d is the mean squared difference between patches in 8-bit levels,
+// so larger strength removes more noise at the cost of detail. Repeated textures are denoised
+// without blurring since similar patches are found across the search window.
+//
+// The cost per pixel is proportional to the number of pixels in the search window times the patch size.
+// patchRadius must be within 0..5, searchRadius within 0..20 and strength within 1..100.
+// Supported shapes are those of [NewConvolve]. Workers defaults to GOMAXPROCS.
+func NewNonLocalMeans(shape pix.Shape, patchRadius, searchRadius int, strength float32) (*NeighborhoodFilter, error) {
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if patchRadius < 0 || patchRadius > maxNLMPatchRadius {
+		return nil, errors.New("non-local means patch radius out of range 0..5")
+	} else if searchRadius < 0 || searchRadius > maxNLMSearchRadius {
+		return nil, errors.New("non-local means search radius out of range 0..20")
+	} else if strength < minNLMStrength || strength > maxNLMStrength {
+		return nil, errors.New("non-local means strength out of range 1..100")
+	}
+	// Samples are converted to 8-bit levels.
+	scale := 1 / float32(int32(1)<<(8*(bpc-1)))
+	var pool sync.Pool
+	f := &NeighborhoodFilter{
+		In:      shape,
+		Out:     shape,
+		Radius:  patchRadius + searchRadius,
+		Border:  BorderMirror,
+		Workers: runtime.GOMAXPROCS(0),
+	}
+	f.Fn = func(dst []byte, win *Window) {
+		pr, sr := patchRadius, searchRadius
+		radius := win.Radius
+		n := (win.Width + 2*radius) * channels
+		// Convert window rows to float once per output row.
+		rows, _ := pool.Get().(*[][]float32)
+		if rows == nil {
+			rows = new([][]float32)
+		}
+		for len(*rows) < 2*radius+1 {
+			*rows = append(*rows, nil)
+		}
+		for i := range 2*radius + 1 {
+			r := (*rows)[i]
+			if cap(r) < n {
+				r = make([]float32, n)
+			}
+			r = r[:n]
+			src := win.Row(i - radius)
+			for j := range r {
+				r[j] = float32(loadSample(src, j, bpc)) * scale
+			}
+			(*rows)[i] = r
+		}
+		at := func(dy int) []float32 { return (*rows)[dy+radius] }
+		inv := -1 / (strength * strength * float32((2*pr+1)*(2*pr+1)*channels))
+		var acc, px [4]float32
+		for x := 0; x < win.Width; x++ {
+			clear(acc[:])
+			var wsum float32
+			for sy := -sr; sy <= sr; sy++ {
+				for sx := -sr; sx <= sr; sx++ {
+					// Squared difference between patches centered at x and x+sx.
+					var d float32
+					for py := -pr; py <= pr; py++ {
+						a := at(py)[(x+radius-pr)*channels:]
+						b := at(sy + py)[(x+sx+radius-pr)*channels:]
+						for i := range (2*pr + 1) * channels {
+							diff := a[i] - b[i]
+							d += diff * diff
+						}
+					}
+					w := float32(math.Exp(float64(d * inv)))
+					q := at(sy)[(x+sx+radius)*channels:]
+					for c := 0; c < channels; c++ {
+						acc[c] += w * q[c]
+					}
+					wsum += w
+				}
+			}
+			for c := 0; c < channels; c++ {
+				px[c] = acc[c] / wsum / scale
+			}
+			storePixel(dst, x, px[:channels], bpc)
+		}
+		pool.Put(rows)
+	}
+	f.Ctrls = []pix.Control{
+		&pix.ControlOrdered[int]{
+			Name:        "Patch Radius",
+			Description: "Radius of the patches compared to find similar pixels",
+			Value:       patchRadius,
+			Min:         0,
+			Max:         maxNLMPatchRadius,
+			Step:        1,
+			OnChange: func(v int) error {
+				patchRadius = v
+				f.Radius = patchRadius + searchRadius
+				return nil
+			},
+		},
+		&pix.ControlOrdered[int]{
+			Name:        "Search Radius",
+			Description: "Radius of the window searched for similar patches",
+			Value:       searchRadius,
+			Min:         0,
+			Max:         maxNLMSearchRadius,
+			Step:        1,
+			OnChange: func(v int) error {
+				searchRadius = v
+				f.Radius = patchRadius + searchRadius
+				return nil
+			},
+		},
+		&pix.ControlOrdered[float32]{
+			Name:        "Strength",
+			Description: "Filtering strength in 8-bit levels. Larger values remove more noise and detail",
+			Value:       strength,
+			Min:         minNLMStrength,
+			Max:         maxNLMStrength,
+			Step:        0.5,
+			OnChange: func(v float32) error {
+				strength = v
+				return nil
+			},
+		},
+	}
+	return f, nil
+}
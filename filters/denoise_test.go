@@ -0,0 +1,116 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+// newNoisyStep returns a grayscale step edge from 60 to 190 at column width/2 with uniform noise of amplitude noise.
+func newNoisyStep(rng *rand.Rand, width, height, noise int) *testImage {
+	img := newStepImage(width, height, width/2, 60, 190)
+	for i := range img.buf {
+		img.buf[i] = byte(int(img.buf[i]) + rng.Intn(2*noise+1) - noise)
+	}
+	return img
+}
+
+// stepError returns the mean absolute error of img against the noiseless step and the largest
+// error of the pixels adjacent to the edge which reveals blurring.
+func stepError(img []byte, width, height int) (mean float64, edge int) {
+	var sum int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			want := 60
+			if x >= width/2 {
+				want = 190
+			}
+			d := int(img[y*width+x]) - want
+			d = max(d, -d)
+			sum += d
+			if x == width/2-1 || x == width/2 {
+				edge = max(edge, d)
+			}
+		}
+	}
+	return float64(sum) / float64(width*height), edge
+}
+
+func TestDenoiseEdgePreserving(t *testing.T) {
+	const width, height = 24, 16
+	noisy := newNoisyStep(newRand(), width, height, 10)
+	noisyMean, _ := stepError(noisy.buf, width, height)
+	bilateral, err := NewBilateral(pix.ShapeGrayscale8bit, 2, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nlm, err := NewNonLocalMeans(pix.ShapeGrayscale8bit, 1, 4, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range []*NeighborhoodFilter{bilateral, nlm} {
+		got := processFilter(t, f, noisy, nil)
+		mean, edge := stepError(got, width, height)
+		if mean > noisyMean/2 {
+			t.Errorf("filter %d: mean error %.2f not halved from %.2f", i, mean, noisyMean)
+		}
+		if edge > 20 {
+			t.Errorf("filter %d: edge blurred by %d levels", i, edge)
+		}
+	}
+}
+
+func TestDenoiseROIParallel(t *testing.T) {
+	for _, shape := range []pix.Shape{pix.ShapeRGB888, pix.ShapeGrayscale16BE} {
+		img := newRandomImage(newRand(), 19, 15, shape)
+		bilateral, err := NewBilateral(shape, 1.5, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nlm, err := NewNonLocalMeans(shape, 1, 2, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rect := image.Rect(3, 2, 17, 13)
+		for i, f := range []*NeighborhoodFilter{bilateral, nlm} {
+			f.Workers = 1
+			want := processFilter(t, f, img, &rect)
+			f.Workers = 4
+			got := processFilter(t, f, readerImage{img}, &rect)
+			if !bytes.Equal(got, want) {
+				t.Errorf("shape %d filter %d: parallel output differs from serial", shape, i)
+			}
+		}
+	}
+}
+
+func TestBilateralControls(t *testing.T) {
+	f, err := NewBilateral(pix.ShapeGrayscale8bit, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if f.Radius != 2 {
+		t.Errorf("radius got %d, want 2", f.Radius)
+	}
+	err = f.Controls()[0].ChangeValue(float32(3.2))
+	if err != nil {
+		t.Fatal(err)
+	} else if f.Radius != 7 {
+		t.Errorf("radius got %d, want 7", f.Radius)
+	}
+}
+
+func TestDenoiseArgs(t *testing.T) {
+	for _, sigmas := range [][2]float32{{0, 10}, {21, 10}, {1, 0.5}, {1, 300}} {
+		if _, err := NewBilateral(pix.ShapeGrayscale8bit, sigmas[0], sigmas[1]); err == nil {
+			t.Errorf("bilateral sigmas %v: expected error", sigmas)
+		}
+	}
+	for _, args := range [][3]int{{-1, 2, 10}, {6, 2, 10}, {1, 21, 10}, {1, 2, 0}, {1, 2, 101}} {
+		if _, err := NewNonLocalMeans(pix.ShapeGrayscale8bit, args[0], args[1], float32(args[2])); err == nil {
+			t.Errorf("non-local means args %v: expected error", args)
+		}
+	}
+}
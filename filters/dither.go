@@ -0,0 +1,216 @@
+package filters
+
+import (
+	"errors"
+
+	"github.com/soypat/pix"
+)
+
+// DitherMode determines the dithering algorithm used when reducing bit depth.
+type DitherMode int
+
+const (
+	// DitherNone rounds every pixel to the nearest representable value.
+	DitherNone DitherMode = iota
+	// DitherFloydSteinberg diffuses the full quantization error to 4 neighbors.
+	DitherFloydSteinberg
+	// DitherAtkinson diffuses 3/4 of the quantization error to 6 neighbors. Produces higher contrast output.
+	DitherAtkinson
+	// DitherSierraLite diffuses the quantization error to 3 neighbors. Cheaper than Floyd-Steinberg with similar results.
+	DitherSierraLite
+	// DitherBayer2x2 is ordered dithering with a 2x2 threshold matrix.
+	DitherBayer2x2
+	// DitherBayer4x4 is ordered dithering with a 4x4 threshold matrix.
+	DitherBayer4x4
+	// DitherBayer8x8 is ordered dithering with a 8x8 threshold matrix.
+	DitherBayer8x8
+)
+
+func (m DitherMode) String() string {
+	switch m {
+	case DitherNone:
+		return "None"
+	case DitherFloydSteinberg:
+		return "Floyd-Steinberg"
+	case DitherAtkinson:
+		return "Atkinson"
+	case DitherSierraLite:
+		return "Sierra Lite"
+	case DitherBayer2x2:
+		return "Bayer 2x2"
+	case DitherBayer4x4:
+		return "Bayer 4x4"
+	case DitherBayer8x8:
+		return "Bayer 8x8"
+	default:
+		return "Unknown"
+	}
+}
+
+// diffusion is a single weight of an error diffusion kernel.
+type diffusion struct {
+	dx, dy int
+	weight int32
+}
+
+// Error diffusion kernels. Weights are in units of 1/16.
+var (
+	kernelFloydSteinberg = []diffusion{{1, 0, 7}, {-1, 1, 3}, {0, 1, 5}, {1, 1, 1}}
+	kernelAtkinson       = []diffusion{{1, 0, 2}, {2, 0, 2}, {-1, 1, 2}, {0, 1, 2}, {1, 1, 2}, {0, 2, 2}}
+	kernelSierraLite     = []diffusion{{1, 0, 8}, {-1, 1, 4}, {0, 1, 4}}
+)
+
+// Bayer threshold matrices.
+var bayer2, bayer4, bayer8 = bayerMatrix(2), bayerMatrix(4), bayerMatrix(8)
+
+// NewDither creates a filter that converts pixels from the in shape to the out shape
+// applying dithering to hide the banding caused by reducing bit depth,
+// i.e: RGB888 to RGB565BE, RGB444BE, Grayscale2bit or Monochrome.
+// Any pair of shapes with a [pix.Codec] is supported.
+func NewDither(out, in pix.Shape, mode DitherMode) (*ScanFilter, error) {
+	inCodec, ok := in.Codec()
+	if !ok {
+		return nil, errors.New("unsupported input shape")
+	}
+	outCodec, ok := out.Codec()
+	if !ok {
+		return nil, errors.New("unsupported output shape")
+	}
+	filterMode := mode
+	steps := quantizationSteps(out)
+	var (
+		width int
+		errs  [3][]int32 // Error rows for current row and 2 rows below. 3 channels per pixel.
+	)
+	const pad = 2 // Error kernels spread at most 2 pixels horizontally.
+	return &ScanFilter{
+		In:  in,
+		Out: out,
+		Begin: func(d pix.Dims) {
+			width = d.Width
+			for i := range errs {
+				errs[i] = make([]int32, 3*(width+2*pad))
+			}
+		},
+		Fn: func(dst, src []byte, y int) {
+			var kernel []diffusion
+			var threshold [][]int32
+			switch filterMode {
+			case DitherFloydSteinberg:
+				kernel = kernelFloydSteinberg
+			case DitherAtkinson:
+				kernel = kernelAtkinson
+			case DitherSierraLite:
+				kernel = kernelSierraLite
+			case DitherBayer2x2:
+				threshold = bayer2
+			case DitherBayer4x4:
+				threshold = bayer4
+			case DitherBayer8x8:
+				threshold = bayer8
+			}
+			var scratch [4]byte
+			cur := errs[0]
+			for x := 0; x < width; x++ {
+				c := inCodec.Decode(src, x)
+				want := [3]int32{int32(c.R), int32(c.G), int32(c.B)}
+				if threshold != nil {
+					n := int32(len(threshold))
+					t := threshold[y%len(threshold)][x%len(threshold)]
+					for ch := range want {
+						// Offset by threshold in range (-step/2, step/2).
+						want[ch] += (2*t + 1 - n*n) * steps[ch] / (2 * n * n)
+					}
+				} else {
+					for ch := range want {
+						want[ch] += cur[3*(x+pad)+ch] / 16
+					}
+				}
+				// Premultiplied color channels may not exceed alpha.
+				c.R, c.G, c.B = clampAlpha(want[0], c.A), clampAlpha(want[1], c.A), clampAlpha(want[2], c.A)
+				outCodec.Encode(scratch[:], 0, c)
+				q := outCodec.Decode(scratch[:], 0)
+				outCodec.Encode(dst, x, q)
+				if kernel == nil {
+					continue
+				}
+				qerr := [3]int32{want[0] - int32(q.R), want[1] - int32(q.G), want[2] - int32(q.B)}
+				for _, k := range kernel {
+					row := errs[k.dy]
+					off := 3 * (x + pad + k.dx)
+					for ch := range qerr {
+						row[off+ch] += qerr[ch] * k.weight
+					}
+				}
+			}
+			// Rotate error rows and clear the new bottom row.
+			errs[0], errs[1], errs[2] = errs[1], errs[2], errs[0]
+			clear(errs[2])
+		},
+		Ctrls: []pix.Control{
+			&pix.ControlEnum[DitherMode]{
+				Name:        "Dither Algorithm",
+				Description: "Algorithm used to hide banding when reducing bit depth",
+				Value:       filterMode,
+				ValidValues: []DitherMode{DitherNone, DitherFloydSteinberg, DitherAtkinson, DitherSierraLite, DitherBayer2x2, DitherBayer4x4, DitherBayer8x8},
+				OnChange: func(m DitherMode) error {
+					filterMode = m
+					return nil
+				},
+			},
+		},
+	}, nil
+}
+
+// quantizationSteps returns the distance between representable values
+// of the red, green and blue channels of the shape in 16 bit units.
+func quantizationSteps(sh pix.Shape) (steps [3]int32) {
+	var bits [3]int32
+	switch sh {
+	case pix.ShapeRGB565BE:
+		bits = [3]int32{5, 6, 5}
+	case pix.ShapeRGB555:
+		bits = [3]int32{5, 5, 5}
+	case pix.ShapeRGB444BE:
+		bits = [3]int32{4, 4, 4}
+	case pix.ShapeGrayscale2bit:
+		bits = [3]int32{2, 2, 2}
+	case pix.ShapeMonochrome:
+		bits = [3]int32{1, 1, 1}
+	case pix.ShapeGrayscale16BE:
+		bits = [3]int32{16, 16, 16}
+	default:
+		bits = [3]int32{8, 8, 8}
+	}
+	for i := range steps {
+		steps[i] = 0xffff / (1<<bits[i] - 1)
+	}
+	return steps
+}
+
+// bayerMatrix returns a n*n Bayer threshold matrix with values in 0..n*n-1. n must be a power of 2.
+func bayerMatrix(n int) [][]int32 {
+	m := [][]int32{{0}}
+	for len(m) < n {
+		sz := len(m)
+		next := make([][]int32, 2*sz)
+		for i := range next {
+			next[i] = make([]int32, 2*sz)
+		}
+		for i := 0; i < sz; i++ {
+			for j := 0; j < sz; j++ {
+				v := 4 * m[i][j]
+				next[i][j] = v
+				next[i][j+sz] = v + 2
+				next[i+sz][j] = v + 3
+				next[i+sz][j+sz] = v + 1
+			}
+		}
+		m = next
+	}
+	return m
+}
+
+func clampAlpha(v int32, alpha uint16) uint16 {
+	return uint16(max(0, min(v, int32(alpha))))
+}
@@ -0,0 +1,78 @@
+package filters
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+func TestDitherPreservesMean(t *testing.T) {
+	const width, height = 64, 64
+	src := &testImage{
+		dims: pix.Dims{Width: width, Height: height, Stride: 3 * width, Shape: pix.ShapeRGB888},
+		buf:  bytes.Repeat([]byte{0x40}, 3*width*height), // 25% gray.
+	}
+	filter, err := NewDither(pix.ShapeMonochrome, pix.ShapeRGB888, DitherNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes := filter.Controls()[0].(*pix.ControlEnum[DitherMode]).ValidValues
+	for _, mode := range modes {
+		err = filter.Controls()[0].ChangeValue(mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := make([]byte, width*height/8)
+		dims, err := filter.Process(dst, src, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		white := 0
+		for y := 0; y < dims.Height; y++ {
+			for x := 0; x < dims.Width; x++ {
+				c, _ := pix.GetPixel(&testImage{dims: dims, buf: dst}, x, y)
+				if c.R != 0 {
+					white++
+				}
+			}
+		}
+		ratio := float64(white) / (width * height)
+		switch {
+		case mode == DitherNone && white != 0:
+			t.Errorf("%s: expected black image from rounding, got %d white pixels", mode, white)
+		case mode == DitherAtkinson && (ratio < 0.15 || ratio > 0.3):
+			// Atkinson discards 1/4 of the error so it is expected to be darker.
+			t.Errorf("%s: got white ratio %.3f", mode, ratio)
+		case mode != DitherNone && mode != DitherAtkinson && (ratio < 0.23 || ratio > 0.27):
+			t.Errorf("%s: got white ratio %.3f, want ~0.25", mode, ratio)
+		}
+	}
+}
+
+func TestDitherNoneMatchesConvert(t *testing.T) {
+	rng := newRand()
+	for _, out := range allShapes {
+		src := newRandomImage(rng, 21, 7, pix.ShapeRGB888)
+		dither, err := NewDither(out, pix.ShapeRGB888, DitherNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		convert, err := NewConvert(out, pix.ShapeRGB888)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make([]byte, 1024)
+		got := make([]byte, 1024)
+		_, err = convert.Process(want, src, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = dither.Process(got, src, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("shape %d: dither without algorithm does not match conversion", out)
+		}
+	}
+}
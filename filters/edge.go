@@ -0,0 +1,358 @@
+package filters
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"github.com/soypat/pix"
+)
+
+// lumaRow converts the channel samples of row to luma in dst, one value per pixel.
+func lumaRow(dst []float32, row []byte, channels, bpc int) {
+	if channels == 1 {
+		for i := range dst {
+			dst[i] = float32(loadSample(row, i, bpc))
+		}
+		return
+	}
+	for i := range dst {
+		p := i * channels
+		r, g, b := loadSample(row, p, bpc), loadSample(row, p+1, bpc), loadSample(row, p+2, bpc)
+		dst[i] = 0.299*float32(r) + 0.587*float32(g) + 0.114*float32(b)
+	}
+}
+
+// newLumaStencil creates a radius 1 neighborhood filter which computes the output
+// from the luma of the 3x3 neighborhood of each pixel. stencil is passed the luma of
+// the three window rows from top to bottom where the neighbors of pixel x are at x, x+1 and x+2.
+// Output is Grayscale16BE for 16-bit input and Grayscale8bit otherwise.
+func newLumaStencil(in pix.Shape, stencil func(l *[3][]float32, x int) float32) (*NeighborhoodFilter, error) {
+	channels, bpc, err := kernelLayout(in)
+	if err != nil {
+		return nil, err
+	}
+	out := pix.ShapeGrayscale8bit
+	if bpc == 2 {
+		out = pix.ShapeGrayscale16BE
+	}
+	maxv := float32(int32(1)<<(8*bpc) - 1)
+	// Luma rows are pooled so the function may be called concurrently.
+	var pool sync.Pool
+	return &NeighborhoodFilter{
+		In:     in,
+		Out:    out,
+		Radius: 1,
+		Border: BorderMirror,
+		Fn: func(dst []byte, win *Window) {
+			l, _ := pool.Get().(*[3][]float32)
+			if l == nil {
+				l = new([3][]float32)
+			}
+			for i := range l {
+				if cap(l[i]) < win.Width+2 {
+					l[i] = make([]float32, win.Width+2)
+				}
+				l[i] = l[i][:win.Width+2]
+				lumaRow(l[i], win.Row(i-1), channels, bpc)
+			}
+			for x := 0; x < win.Width; x++ {
+				v := max(0, min(stencil(l, x), maxv))
+				storeSample(dst, x, bpc, int32(v+0.5))
+			}
+			pool.Put(l)
+		},
+	}, nil
+}
+
+// newGradient creates a gradient magnitude filter from the horizontal derivative kernel
+// [-a 0 a; -b 0 b; -a 0 a] and its transpose. Magnitude is divided by 2a+b, the weight sum of one
+// side of the kernel, so a step edge of height h has magnitude h.
+func newGradient(in pix.Shape, a, b float32) (*NeighborhoodFilter, error) {
+	norm := 1 / (2*a + b)
+	return newLumaStencil(in, func(l *[3][]float32, x int) float32 {
+		top, mid, bot := l[0][x:x+3], l[1][x:x+3], l[2][x:x+3]
+		gx := a*(top[2]-top[0]) + b*(mid[2]-mid[0]) + a*(bot[2]-bot[0])
+		gy := a*(bot[0]-top[0]) + b*(bot[1]-top[1]) + a*(bot[2]-top[2])
+		return norm * float32(math.Sqrt(float64(gx*gx+gy*gy)))
+	})
+}
+
+// NewSobel creates a filter which outputs the Sobel gradient magnitude of the luma of the input.
+// Supported input shapes are those of [NewConvolve]. Output is Grayscale16BE for Grayscale16BE input
+// and Grayscale8bit otherwise. The magnitude is normalized so a step edge of height h has magnitude h.
+func NewSobel(in pix.Shape) (*NeighborhoodFilter, error) {
+	return newGradient(in, 1, 2)
+}
+
+// NewScharr is like [NewSobel] using the Scharr kernel which has better rotational symmetry.
+func NewScharr(in pix.Shape) (*NeighborhoodFilter, error) {
+	return newGradient(in, 3, 10)
+}
+
+// NewLaplacian creates a filter which outputs the absolute value of the 4-neighbor Laplacian of the luma of the input.
+// Supported shapes are those of [NewSobel].
+func NewLaplacian(in pix.Shape) (*NeighborhoodFilter, error) {
+	return newLumaStencil(in, func(l *[3][]float32, x int) float32 {
+		v := l[0][x+1] + l[2][x+1] + l[1][x] + l[1][x+2] - 4*l[1][x+1]
+		return max(v, -v)
+	})
+}
+
+// Canny is the Canny edge detector. It outputs a [pix.ShapeMonochrome] image where set pixels are edges.
+// The luma of the input is smoothed with a gaussian, Sobel gradients are thinned to one pixel wide
+// ridges with non-maximum suppression and edges are traced with hysteresis: pixels with
+// gradient magnitude over the high threshold are edges and so are pixels over the low
+// threshold connected to an edge. Thresholds are in 8-bit levels like the output of [NewSobel].
+//
+// Edge tracing requires the complete ROI so Canny stores a few float32 values per ROI pixel.
+// Any input shape with a codec is supported.
+type Canny struct {
+	in        pix.Shape
+	sigma     float32
+	low, high float32
+	ctrls     []pix.Control
+}
+
+// NewCanny creates a Canny edge detector with gaussian smoothing of standard deviation 1.4.
+func NewCanny(in pix.Shape, low, high float32) (*Canny, error) {
+	if _, ok := in.Codec(); !ok {
+		return nil, errors.New("no codec for input shape")
+	} else if low < 0 || low > high {
+		return nil, errors.New("canny thresholds must satisfy 0<=low<=high")
+	}
+	c := &Canny{in: in, sigma: 1.4, low: low, high: high}
+	c.ctrls = []pix.Control{
+		&pix.ControlOrdered[float32]{
+			Name:        "Low Threshold",
+			Description: "Gradient magnitude over which pixels connected to edges are edges",
+			Value:       low,
+			Min:         0,
+			Max:         1000,
+			Step:        1,
+			OnChange: func(v float32) error {
+				c.low = v
+				return nil
+			},
+		},
+		&pix.ControlOrdered[float32]{
+			Name:        "High Threshold",
+			Description: "Gradient magnitude over which pixels are edges",
+			Value:       high,
+			Min:         0,
+			Max:         1000,
+			Step:        1,
+			OnChange: func(v float32) error {
+				c.high = v
+				return nil
+			},
+		},
+		&pix.ControlOrdered[float32]{
+			Name:        "Sigma",
+			Description: "Standard deviation in pixels of the gaussian smoothing applied before differentiation",
+			Value:       c.sigma,
+			Min:         0,
+			Max:         10,
+			Step:        0.1,
+			OnChange: func(v float32) error {
+				c.sigma = v
+				return nil
+			},
+		},
+	}
+	return c, nil
+}
+
+// ShapeIO implements [pix.Filter].
+func (c *Canny) ShapeIO() (output, input pix.Shape) {
+	return pix.ShapeMonochrome, c.in
+}
+
+// Controls implements [pix.Filter].
+func (c *Canny) Controls() []pix.Control {
+	return c.ctrls
+}
+
+// Process implements [pix.Filter].
+func (c *Canny) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	if src.Dims().Shape != c.in {
+		return pix.Dims{}, errShapeMismatch
+	} else if c.low > c.high {
+		return pix.Dims{}, errors.New("canny low threshold exceeds high threshold")
+	}
+	inPlace := dst == nil
+	dst, srcDims, err := pix.ValidateProcessArgs(dst, pix.Dims{Shape: pix.ShapeMonochrome}, src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	r := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	if roi != nil {
+		r = *roi
+	}
+	dstDims := pix.Dims{Width: r.Dx(), Height: r.Dy(), Shape: pix.ShapeMonochrome}
+	dstDims.Stride = dstDims.SizeRow()
+	dstOff, dstBitOff := 0, 0
+	if inPlace {
+		dstDims.Stride = srcDims.Stride
+		dstOff, dstBitOff = r.Min.Y*srcDims.Stride, r.Min.X
+	} else if int64(len(dst)) < dstDims.Size() {
+		return pix.Dims{}, errors.New("destination buffer not large enough to store output")
+	}
+
+	kernel := gaussianKernel(c.sigma)
+	// Smoothed luma is needed 2 pixels around the ROI for gradients and non-maximum suppression.
+	ex := r.Inset(-(len(kernel)/2 + 2))
+	lum, err := c.loadLuma(src, srcDims, ex)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	blurLuma(lum, ex.Dx(), ex.Dy(), kernel)
+
+	// Sobel gradients over the ROI and a 1 pixel ring around it.
+	gw, gh := r.Dx()+2, r.Dy()+2
+	mag := make([]float32, gw*gh)
+	gxs := make([]float32, gw*gh)
+	gys := make([]float32, gw*gh)
+	off := len(kernel)/2 + 1 // Offset of gradient grid within ex.
+	exw := ex.Dx()
+	for y := 0; y < gh; y++ {
+		for x := 0; x < gw; x++ {
+			i := (y+off)*exw + x + off
+			top, mid, bot := lum[i-exw-1:i-exw+2], lum[i-1:i+2], lum[i+exw-1:i+exw+2]
+			gx := (top[2] - top[0] + 2*(mid[2]-mid[0]) + bot[2] - bot[0]) / 4
+			gy := (bot[0] - top[0] + 2*(bot[1]-top[1]) + bot[2] - top[2]) / 4
+			j := y*gw + x
+			gxs[j], gys[j] = gx, gy
+			mag[j] = float32(math.Sqrt(float64(gx*gx + gy*gy)))
+		}
+	}
+
+	// Non-maximum suppression and double threshold.
+	const (
+		none = iota
+		weak
+		strong
+	)
+	w, h := r.Dx(), r.Dy()
+	edges := make([]uint8, w*h)
+	var stack []int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			j := (y+1)*gw + x + 1
+			m := mag[j]
+			if m < c.low || m == 0 {
+				continue
+			}
+			gx, gy := gxs[j], gys[j]
+			ax, ay := max(gx, -gx), max(gy, -gy)
+			var step int // Offset to the neighbor along the gradient direction.
+			switch {
+			case ay <= 0.41421356*ax: // tan(22.5°)
+				step = 1
+			case ay >= 2.41421356*ax: // tan(67.5°)
+				step = gw
+			case gx*gy > 0:
+				step = gw + 1
+			default:
+				step = gw - 1
+			}
+			if m <= mag[j-step] || m < mag[j+step] {
+				continue
+			}
+			i := y*w + x
+			if m >= c.high {
+				edges[i] = strong
+				stack = append(stack, i)
+			} else {
+				edges[i] = weak
+			}
+		}
+	}
+	// Hysteresis: promote weak pixels 8-connected to strong pixels.
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%w, i/w
+		for ny := max(0, y-1); ny <= min(h-1, y+1); ny++ {
+			for nx := max(0, x-1); nx <= min(w-1, x+1); nx++ {
+				n := ny*w + nx
+				if edges[n] == weak {
+					edges[n] = strong
+					stack = append(stack, n)
+				}
+			}
+		}
+	}
+
+	row := make([]byte, dstDims.SizeRow())
+	for y := 0; y < h; y++ {
+		clear(row)
+		for x, e := range edges[y*w : (y+1)*w] {
+			if e == strong {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		pix.CopyBits(dst[dstOff+y*dstDims.Stride:], dstBitOff, row, 0, w)
+	}
+	return dstDims, nil
+}
+
+// loadLuma returns the luma in 8-bit levels of the pixels of rectangle ex, which may exceed
+// the image bounds in which case pixels are mirrored.
+func (c *Canny) loadLuma(src pix.Image, srcDims pix.Dims, ex image.Rectangle) ([]float32, error) {
+	codec, _ := c.in.Codec()
+	// Mirrored columns lie within the columns of ex which are inside the image.
+	x0, x1 := max(0, ex.Min.X), min(srcDims.Width, ex.Max.X)
+	colors := make([]color.RGBA64, x1-x0)
+	rowBuf := make([]byte, srcDims.SizeRow())
+	lum := make([]float32, ex.Dx()*ex.Dy())
+	for y := ex.Min.Y; y < ex.Max.Y; y++ {
+		row, err := pix.ImageRow(rowBuf, src, borderIndex(y, srcDims.Height, BorderMirror))
+		if err != nil {
+			return nil, err
+		}
+		codec.DecodeRow(colors, row, x0)
+		dst := lum[(y-ex.Min.Y)*ex.Dx():]
+		for x := ex.Min.X; x < ex.Max.X; x++ {
+			cl := colors[borderIndex(x, srcDims.Width, BorderMirror)-x0]
+			l := (19595*uint32(cl.R) + 38470*uint32(cl.G) + 7471*uint32(cl.B) + 1<<15) >> 16
+			dst[x-ex.Min.X] = float32(l) / 257
+		}
+	}
+	return lum, nil
+}
+
+// blurLuma applies the separable kernel to the w by h lum image in place. Pixels closer
+// than the kernel radius to the image edge are only partially blurred.
+func blurLuma(lum []float32, w, h int, kernel []float32) {
+	radius := len(kernel) / 2
+	if radius == 0 {
+		return
+	}
+	tmp := make([]float32, max(w, h))
+	for y := 0; y < h; y++ {
+		row := lum[y*w : (y+1)*w]
+		for x := radius; x < w-radius; x++ {
+			var acc float32
+			for j, k := range kernel {
+				acc += k * row[x+j-radius]
+			}
+			tmp[x] = acc
+		}
+		copy(row[radius:w-radius], tmp[radius:w-radius])
+	}
+	for x := 0; x < w; x++ {
+		for y := radius; y < h-radius; y++ {
+			var acc float32
+			for j, k := range kernel {
+				acc += k * lum[(y+j-radius)*w+x]
+			}
+			tmp[y] = acc
+		}
+		for y := radius; y < h-radius; y++ {
+			lum[y*w+x] = tmp[y]
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package filters
+
+import (
+	"image"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+// newStepImage returns a grayscale image with value lo left of column edge and hi from it on.
+func newStepImage(width, height, edge int, lo, hi byte) *testImage {
+	img := &testImage{dims: pix.Dims{Width: width, Height: height, Stride: width, Shape: pix.ShapeGrayscale8bit}, buf: make([]byte, width*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.buf[y*width+x] = lo
+			if x >= edge {
+				img.buf[y*width+x] = hi
+			}
+		}
+	}
+	return img
+}
+
+func TestGradientStepEdge(t *testing.T) {
+	const width, height, edge = 12, 6, 6
+	img := newStepImage(width, height, edge, 50, 150)
+	sobel, err := NewSobel(pix.ShapeGrayscale8bit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scharr, err := NewScharr(pix.ShapeGrayscale8bit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	laplacian, err := NewLaplacian(pix.ShapeGrayscale8bit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []*NeighborhoodFilter{sobel, scharr, laplacian} {
+		got := processFilter(t, f, img, nil)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				want := byte(0)
+				if x == edge-1 || x == edge {
+					want = 100
+				}
+				if v := got[y*width+x]; v != want {
+					t.Fatalf("pixel (%d,%d) got %d, want %d", x, y, v, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSobelRGB(t *testing.T) {
+	img := newRandomImage(newRand(), 10, 8, pix.ShapeRGB888)
+	f, err := NewSobel(pix.ShapeRGB888)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := f.ShapeIO()
+	if out != pix.ShapeGrayscale8bit {
+		t.Fatalf("sobel output shape got %d", out)
+	}
+	rect := image.Rect(2, 2, 9, 7)
+	got := processFilter(t, f, img, &rect)
+	full := processFilter(t, f, img, nil)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if got[(y-rect.Min.Y)*rect.Dx()+x-rect.Min.X] != full[y*10+x] {
+				t.Fatalf("ROI pixel (%d,%d) differs from full image", x, y)
+			}
+		}
+	}
+}
+
+func monochromeAt(buf []byte, stride, x, y int) bool {
+	return buf[y*stride+x/8]&(0x80>>(x%8)) != 0
+}
+
+func TestCanny(t *testing.T) {
+	const width, height = 24, 20
+	square := image.Rect(6, 5, 18, 15)
+	img := &testImage{dims: pix.Dims{Width: width, Height: height, Stride: width, Shape: pix.ShapeGrayscale8bit}, buf: make([]byte, width*height)}
+	for y := square.Min.Y; y < square.Max.Y; y++ {
+		for x := square.Min.X; x < square.Max.X; x++ {
+			img.buf[y*width+x] = 200
+		}
+	}
+	canny, err := NewCanny(pix.ShapeGrayscale8bit, 10, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := processFilter(t, canny, img, nil)
+	stride := (width + 7) / 8
+	inner, outer := square.Inset(2), square.Inset(-2)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := image.Pt(x, y)
+			nearEdge := p.In(outer) && !p.In(inner)
+			if monochromeAt(got, stride, x, y) && !nearEdge {
+				t.Errorf("unexpected edge at %v", p)
+			}
+		}
+	}
+	// Every row crossing the square has an edge on both sides.
+	for y := square.Min.Y + 1; y < square.Max.Y-1; y++ {
+		left, right := false, false
+		for x := outer.Min.X; x < inner.Min.X; x++ {
+			left = left || monochromeAt(got, stride, x, y)
+		}
+		for x := inner.Max.X; x < outer.Max.X; x++ {
+			right = right || monochromeAt(got, stride, x, y)
+		}
+		if !left || !right {
+			t.Errorf("row %d missing edge left=%v right=%v", y, left, right)
+		}
+	}
+
+	// Without hysteresis a ROI matches the crop of the full output.
+	err = canny.Controls()[0].ChangeValue(float32(30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := processFilter(t, canny, img, nil)
+	rect := image.Rect(3, 4, 20, 11)
+	crop := processFilter(t, canny, readerImage{img}, &rect)
+	cropStride := (rect.Dx() + 7) / 8
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if monochromeAt(full, stride, x, y) != monochromeAt(crop, cropStride, x-rect.Min.X, y-rect.Min.Y) {
+				t.Fatalf("ROI pixel (%d,%d) differs from full image", x, y)
+			}
+		}
+	}
+}
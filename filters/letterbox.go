@@ -0,0 +1,360 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/soypat/geometry/ms2"
+	"github.com/soypat/pix"
+)
+
+// LetterboxAlign selects where the scaled image is placed within the letterbox.
+type LetterboxAlign int
+
+const (
+	// LetterboxCenter centers the image, splitting padding between both sides.
+	LetterboxCenter LetterboxAlign = iota
+	// LetterboxTopLeft places the image at the top left corner, padding only the right and bottom.
+	LetterboxTopLeft
+	// LetterboxBottomRight places the image at the bottom right corner, padding only the left and top.
+	LetterboxBottomRight
+)
+
+func (a LetterboxAlign) String() string {
+	switch a {
+	case LetterboxCenter:
+		return "Center"
+	case LetterboxTopLeft:
+		return "TopLeft"
+	case LetterboxBottomRight:
+		return "BottomRight"
+	default:
+		return "Unknown"
+	}
+}
+
+// LetterboxTransform maps coordinates between source image space and letterboxed space.
+// A source point p maps to Scale*p+Offset, with the product taken per component.
+// Coordinates are continuous: pixel (x,y) covers the square from (x,y) to (x+1,y+1),
+// so pixel centers lie at half-integer coordinates in both spaces.
+type LetterboxTransform struct {
+	Scale  ms2.Vec
+	Offset ms2.Vec
+}
+
+// ToLetterbox maps point p in source image coordinates to letterboxed coordinates.
+func (t LetterboxTransform) ToLetterbox(p ms2.Vec) ms2.Vec {
+	return ms2.Add(ms2.MulElem(t.Scale, p), t.Offset)
+}
+
+// FromLetterbox maps point p in letterboxed coordinates back to source image coordinates,
+// i.e: to map detections of a model back to the original image.
+func (t LetterboxTransform) FromLetterbox(p ms2.Vec) ms2.Vec {
+	return ms2.DivElem(ms2.Sub(p, t.Offset), t.Scale)
+}
+
+// BoxToLetterbox maps box b in source image coordinates to letterboxed coordinates.
+func (t LetterboxTransform) BoxToLetterbox(b ms2.Box) ms2.Box {
+	return ms2.Box{Min: t.ToLetterbox(b.Min), Max: t.ToLetterbox(b.Max)}
+}
+
+// BoxFromLetterbox maps box b in letterboxed coordinates back to source image coordinates.
+// Boxes overlapping the padding map outside the source image and may need clipping with [ms2.Box.Intersect].
+func (t LetterboxTransform) BoxFromLetterbox(b ms2.Box) ms2.Box {
+	return ms2.Box{Min: t.FromLetterbox(b.Min), Max: t.FromLetterbox(b.Max)}
+}
+
+// Letterbox is a filter which scales the source image or ROI preserving its aspect ratio to fit
+// a fixed width x height output and fills the remaining area with a pad color, as expected by
+// object detectors such as YOLO. Use [Letterbox.Transform] to map detections back to source coordinates.
+//
+// The image is scaled with [Resize] so it streams with the same memory use and supports
+// the same byte-aligned shapes. Letterbox does not support in-place processing.
+type Letterbox struct {
+	shape         pix.Shape
+	width, height int
+	kernel        ResizeKernel
+	align         LetterboxAlign
+	layout        floatLayout
+	pad           []byte // Pad color encoded as a single pixel.
+	ctrls         []pix.Control
+}
+
+var (
+	_ pix.DimsFilter   = (*Letterbox)(nil)
+	_ pix.StreamFilter = (*Letterbox)(nil)
+	_ pix.RowProcessor = (*Letterbox)(nil)
+)
+
+// NewLetterbox creates a letterbox filter with a width x height output for images of the given shape.
+// The image is scaled with kernel, placed according to align and padded with pad.
+// All parameters except shape can be changed with the filter's controls.
+func NewLetterbox(shape pix.Shape, width, height int, kernel ResizeKernel, pad color.RGBA64, align LetterboxAlign) (*Letterbox, error) {
+	layout, err := newFloatLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if width <= 0 || height <= 0 {
+		return nil, errors.New("letterbox dimensions must be positive")
+	} else if kernel < ResizeNearest || kernel > ResizeLanczos3 {
+		return nil, errors.New("invalid resize kernel")
+	} else if align < LetterboxCenter || align > LetterboxBottomRight {
+		return nil, errors.New("invalid letterbox alignment")
+	}
+	lb := &Letterbox{shape: shape, width: width, height: height, kernel: kernel, align: align, layout: layout}
+	lb.setPad(pad)
+	lb.ctrls = []pix.Control{
+		&pix.ControlOrdered[int]{
+			Name:        "Width",
+			Description: "Width in pixels of the letterboxed image",
+			Value:       width,
+			Min:         1,
+			Max:         math.MaxUint16,
+			Step:        1,
+			OnChange: func(v int) error {
+				lb.width = v
+				return nil
+			},
+		},
+		&pix.ControlOrdered[int]{
+			Name:        "Height",
+			Description: "Height in pixels of the letterboxed image",
+			Value:       height,
+			Min:         1,
+			Max:         math.MaxUint16,
+			Step:        1,
+			OnChange: func(v int) error {
+				lb.height = v
+				return nil
+			},
+		},
+		&pix.ControlEnum[ResizeKernel]{
+			Name:        "Kernel",
+			Description: "Interpolation kernel used to scale the image",
+			Value:       kernel,
+			ValidValues: []ResizeKernel{ResizeNearest, ResizeBilinear, ResizeCatmullRom, ResizeMitchell, ResizeArea, ResizeLanczos3},
+			OnChange: func(k ResizeKernel) error {
+				lb.kernel = k
+				return nil
+			},
+		},
+		&pix.ControlColor{
+			Name:        "Pad",
+			Description: "Color of the padding around the scaled image",
+			Value:       pad,
+			OnChange: func(c color.RGBA64) error {
+				lb.setPad(c)
+				return nil
+			},
+		},
+		&pix.ControlEnum[LetterboxAlign]{
+			Name:        "Alignment",
+			Description: "Placement of the scaled image within the letterbox",
+			Value:       align,
+			ValidValues: []LetterboxAlign{LetterboxCenter, LetterboxTopLeft, LetterboxBottomRight},
+			OnChange: func(a LetterboxAlign) error {
+				lb.align = a
+				return nil
+			},
+		},
+	}
+	return lb, nil
+}
+
+func (lb *Letterbox) setPad(c color.RGBA64) {
+	// Clamp to a valid premultiplied color so shapes with alpha encode it consistently.
+	c.R, c.G, c.B = min(c.R, c.A), min(c.G, c.A), min(c.B, c.A)
+	codec, _ := lb.shape.Codec()
+	lb.pad = make([]byte, lb.shape.BitsPerPixel()/8)
+	codec.Encode(lb.pad, 0, c)
+}
+
+// ShapeIO implements [pix.Filter].
+func (lb *Letterbox) ShapeIO() (output, input pix.Shape) {
+	return lb.shape, lb.shape
+}
+
+// Controls implements [pix.Filter].
+func (lb *Letterbox) Controls() []pix.Control {
+	return lb.ctrls
+}
+
+// OutputDims implements [pix.DimsFilter]. The output size does not depend on src or roi.
+func (lb *Letterbox) OutputDims(src pix.Dims, roi *image.Rectangle) (pix.Dims, error) {
+	if src.Shape != lb.shape {
+		return pix.Dims{}, errShapeMismatch
+	}
+	d := pix.Dims{Width: lb.width, Height: lb.height, Shape: lb.shape}
+	d.Stride = d.SizeRow()
+	return d, nil
+}
+
+// Transform returns the transform between coordinates of src and the letterboxed output
+// of processing src with roi. Source coordinates are those of src, not relative to roi.
+func (lb *Letterbox) Transform(src pix.Dims, roi *image.Rectangle) (LetterboxTransform, error) {
+	if err := src.Validate(); err != nil {
+		return LetterboxTransform{}, err
+	}
+	r := image.Rect(0, 0, src.Width, src.Height)
+	if roi != nil {
+		if !roi.In(r) || roi.Empty() {
+			return LetterboxTransform{}, errors.New("ROI exceeds image bounds or is empty")
+		}
+		r = *roi
+	}
+	content := lb.content(r.Size())
+	// Scale is per axis since content size is rounded to whole pixels.
+	scale := ms2.Vec{X: float32(content.Dx()) / float32(r.Dx()), Y: float32(content.Dy()) / float32(r.Dy())}
+	origin := ms2.Vec{X: float32(r.Min.X), Y: float32(r.Min.Y)}
+	offset := ms2.Vec{X: float32(content.Min.X), Y: float32(content.Min.Y)}
+	return LetterboxTransform{Scale: scale, Offset: ms2.Sub(offset, ms2.MulElem(scale, origin))}, nil
+}
+
+// content returns the region of the output covered by a scaled source image of the given size.
+func (lb *Letterbox) content(size image.Point) image.Rectangle {
+	s := min(float64(lb.width)/float64(size.X), float64(lb.height)/float64(size.Y))
+	cw := min(lb.width, max(1, int(math.Round(float64(size.X)*s))))
+	ch := min(lb.height, max(1, int(math.Round(float64(size.Y)*s))))
+	var off image.Point
+	switch lb.align {
+	case LetterboxCenter:
+		off = image.Pt((lb.width-cw)/2, (lb.height-ch)/2)
+	case LetterboxBottomRight:
+		off = image.Pt(lb.width-cw, lb.height-ch)
+	}
+	return image.Rectangle{Min: off, Max: off.Add(image.Pt(cw, ch))}
+}
+
+// Process implements [pix.Filter]. dst must not be nil and output rows are packed.
+func (lb *Letterbox) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	return lb.ProcessContext(context.Background(), dst, src, roi, nil)
+}
+
+// ProcessContext implements [pix.ContextFilter]. ctx is checked between output rows.
+func (lb *Letterbox) ProcessContext(ctx context.Context, dst []byte, src pix.Image, roi *image.Rectangle, progress pix.ProgressFunc) (pix.Dims, error) {
+	if dst == nil {
+		return pix.Dims{}, errors.New("letterbox does not support in-place processing")
+	}
+	outDims, r, err := lb.validate(src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	} else if int64(len(dst)) < outDims.Size() {
+		return pix.Dims{}, errors.New("destination buffer not large enough to store output")
+	}
+	err = lb.rows(ctx, src, r, 0, outDims.Height, progress, func(y int, row []byte) error {
+		copy(dst[y*outDims.Stride:], row)
+		return nil
+	})
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	return outDims, nil
+}
+
+// ProcessTo implements [pix.StreamFilter]. Only the source rows spanned by the resize kernel
+// and a single output row are kept in memory.
+func (lb *Letterbox) ProcessTo(dst pix.ImageWriter, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	outDims, r, err := lb.validate(src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	dstDims, _, err := pix.ValidateWriterArgs(dst, outDims, src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	err = lb.rows(context.Background(), src, r, 0, outDims.Height, nil, func(y int, row []byte) error {
+		_, err := dst.WriteAt(row, int64(y)*int64(dstDims.Stride))
+		return err
+	})
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	outDims.Stride = dstDims.Stride
+	return outDims, nil
+}
+
+// ProcessRows implements [pix.RowProcessor]. Rows entirely within the padding read no source rows.
+func (lb *Letterbox) ProcessRows(dst []byte, stride int, src pix.Image, roi *image.Rectangle, y0, y1 int) error {
+	outDims, r, err := lb.validate(src, roi)
+	if err != nil {
+		return err
+	} else if y0 < 0 || y1 > outDims.Height || y0 >= y1 {
+		return errors.New("invalid row range")
+	} else if stride < outDims.SizeRow() || len(dst) < (y1-y0-1)*stride+outDims.SizeRow() {
+		return errors.New("destination buffer not large enough to store output")
+	}
+	return lb.rows(context.Background(), src, r, y0, y1, nil, func(y int, row []byte) error {
+		copy(dst[(y-y0)*stride:], row)
+		return nil
+	})
+}
+
+// validate checks src and roi and returns the output dimensions and the source region to letterbox.
+func (lb *Letterbox) validate(src pix.Image, roi *image.Rectangle) (pix.Dims, image.Rectangle, error) {
+	srcDims := src.Dims()
+	if srcDims.Shape != lb.shape {
+		return pix.Dims{}, image.Rectangle{}, errShapeMismatch
+	}
+	outDims, err := pix.OutputDims(lb, srcDims, roi)
+	if err != nil {
+		return pix.Dims{}, image.Rectangle{}, err
+	}
+	r := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	if roi != nil {
+		r = *roi
+	}
+	return outDims, r, nil
+}
+
+// rows computes output rows y0 to y1 of letterboxing region r of src and passes them to sink in order.
+func (lb *Letterbox) rows(ctx context.Context, src pix.Image, r image.Rectangle, y0, y1 int, progress pix.ProgressFunc, sink func(y int, row []byte) error) error {
+	content := lb.content(r.Size())
+	rz := Resize{shape: lb.shape, width: content.Dx(), height: content.Dy(), kernel: lb.kernel, layout: lb.layout}
+	bpp := len(lb.pad)
+	out := make([]byte, lb.width*bpp)
+	for i := 0; i < len(out); i += bpp {
+		copy(out[i:], lb.pad)
+	}
+	emit := func(y int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		} else if err := sink(y, out); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(y-y0+1, y1-y0)
+		}
+		return nil
+	}
+	// Padding rows above the image.
+	y := y0
+	for ; y < min(y1, content.Min.Y); y++ {
+		if err := emit(y); err != nil {
+			return err
+		}
+	}
+	// Image rows keep the left and right padding of out and replace the content span.
+	if end := min(y1, content.Max.Y); y < end {
+		span := out[content.Min.X*bpp : content.Max.X*bpp]
+		err := rz.rows(ctx, src, r, y-content.Min.Y, end-content.Min.Y, nil, func(ry int, row []byte) error {
+			copy(span, row)
+			return emit(ry + content.Min.Y)
+		})
+		if err != nil {
+			return err
+		}
+		y = end
+		// Restore padding for the rows below the image.
+		for i := 0; i < len(span); i += bpp {
+			copy(span[i:], lb.pad)
+		}
+	}
+	for ; y < y1; y++ {
+		if err := emit(y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/soypat/geometry/ms2"
+	"github.com/soypat/pix"
+)
+
+func TestLetterbox(t *testing.T) {
+	pad := color.RGBA64{R: 0x7272, G: 0x7272, B: 0x7272, A: 0xffff}
+	for _, shape := range byteAlignedShapes {
+		img := newRandomImage(newRand(), 23, 17, shape)
+		premultiply(img)
+		bpp := shape.BitsPerPixel() / 8
+		padPx := make([]byte, bpp)
+		codec, _ := shape.Codec()
+		codec.Encode(padPx, 0, pad)
+		for _, roi := range []image.Rectangle{image.Rect(2, 3, 21, 10), image.Rect(4, 0, 9, 17)} {
+			sub, err := pix.SubImage(img, roi)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, align := range []LetterboxAlign{LetterboxCenter, LetterboxTopLeft, LetterboxBottomRight} {
+				lb, err := NewLetterbox(shape, 16, 12, ResizeBilinear, pad, align)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]byte, 16*12*bpp)
+				d, err := lb.Process(got, readerImage{img}, &roi)
+				if err != nil {
+					t.Fatal(err)
+				} else if d.Width != 16 || d.Height != 12 {
+					t.Fatalf("got output %dx%d, want 16x12", d.Width, d.Height)
+				}
+				// Content must match resizing the ROI to the content size and the rest must be padding.
+				content := lb.content(roi.Size())
+				rz, err := NewResize(shape, content.Dx(), content.Dy(), ResizeBilinear)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := processFilter(t, rz, sub, nil)
+				for y := 0; y < 12; y++ {
+					for x := 0; x < 16; x++ {
+						px := got[(y*16+x)*bpp:][:bpp]
+						p := image.Pt(x, y)
+						if p.In(content) {
+							wantPx := want[((y-content.Min.Y)*content.Dx()+x-content.Min.X)*bpp:][:bpp]
+							if !bytes.Equal(px, wantPx) {
+								t.Fatalf("shape %d %s roi %v: content pixel %v got %v, want %v", shape, align, roi, p, px, wantPx)
+							}
+						} else if !bytes.Equal(px, padPx) {
+							t.Fatalf("shape %d %s roi %v: pad pixel %v got %v, want %v", shape, align, roi, p, px, padPx)
+						}
+					}
+				}
+
+				lazy, err := pix.NewLazyImage(lb, readerImage{img}, &roi)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lazyGot, err := io.ReadAll(io.NewSectionReader(lazy, 0, lazy.Dims().Size()))
+				if err != nil {
+					t.Fatal(err)
+				} else if !bytes.Equal(lazyGot, got) {
+					t.Fatalf("shape %d %s: lazy letterbox differs", shape, align)
+				}
+
+				buf := make(sliceWriterAt, len(got))
+				w, err := pix.NewImageWriter(buf, d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = lb.ProcessTo(w, readerImage{img}, &roi); err != nil {
+					t.Fatal(err)
+				} else if !bytes.Equal(buf, got) {
+					t.Fatalf("shape %d %s: ProcessTo differs", shape, align)
+				}
+			}
+		}
+	}
+}
+
+func TestLetterboxTransform(t *testing.T) {
+	lb, err := NewLetterbox(pix.ShapeRGB888, 320, 320, ResizeBilinear, color.RGBA64{}, LetterboxCenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := pix.Dims{Width: 640, Height: 480, Shape: pix.ShapeRGB888}
+	src.Stride = src.SizeRow()
+	tf, err := lb.Transform(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LetterboxTransform{Scale: ms2.Vec{X: 0.5, Y: 0.5}, Offset: ms2.Vec{X: 0, Y: 40}}
+	if tf != want {
+		t.Fatalf("got transform %+v, want %+v", tf, want)
+	}
+	// Source image corners map to the content corners.
+	got := tf.BoxToLetterbox(ms2.NewBox(0, 0, 640, 480))
+	if !got.Equal(ms2.NewBox(0, 40, 320, 280), 1e-4) {
+		t.Errorf("image box mapped to %+v", got)
+	}
+
+	roi := image.Rect(100, 50, 300, 450)
+	tf, err = lb.Transform(src, &roi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ROI scales by 0.8 to 160x320 centered horizontally.
+	got = tf.BoxToLetterbox(ms2.NewBox(100, 50, 300, 450))
+	if !got.Equal(ms2.NewBox(80, 0, 240, 320), 1e-4) {
+		t.Errorf("ROI box mapped to %+v", got)
+	}
+	det := ms2.NewBox(100, 20, 130, 75)
+	back := tf.BoxToLetterbox(tf.BoxFromLetterbox(det))
+	if !back.Equal(det, 1e-3) {
+		t.Errorf("round trip of %+v got %+v", det, back)
+	}
+	if _, err = lb.Transform(src, &image.Rectangle{Max: image.Pt(700, 10)}); err == nil {
+		t.Error("expected error for ROI out of bounds")
+	}
+}
+
+func TestLetterboxControls(t *testing.T) {
+	lb, err := NewLetterbox(pix.ShapeGrayscale8bit, 4, 6, ResizeNearest, color.RGBA64{}, LetterboxCenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := newRandomImage(newRand(), 2, 2, pix.ShapeGrayscale8bit)
+	for _, ctrl := range lb.Controls() {
+		var err error
+		switch name, _ := ctrl.Describe(); name {
+		case "Pad":
+			err = ctrl.ChangeValue(color.Gray{Y: 200})
+		case "Alignment":
+			err = ctrl.ChangeValue(LetterboxTopLeft)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make([]byte, 4*6)
+	if _, err = lb.Process(got, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	// A 2x2 image scales to 4x4 at the top leaving two rows of padding.
+	for i, v := range got[4*4:] {
+		if v != 200 {
+			t.Fatalf("padding byte %d got %d, want 200", i, v)
+		}
+	}
+	if got[0] != img.buf[0] || got[3] != img.buf[1] {
+		t.Errorf("content not aligned to top left: %v", got[:4])
+	}
+}
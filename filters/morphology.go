@@ -0,0 +1,392 @@
+package filters
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+
+	"github.com/soypat/pix"
+)
+
+// MorphOp is a binary morphology operation.
+type MorphOp int
+
+const (
+	// MorphErode keeps set pixels whose neighborhood under the structuring element is all set. Shrinks objects.
+	MorphErode MorphOp = iota
+	// MorphDilate sets pixels with any set pixel in the reflected structuring element. Grows objects.
+	MorphDilate
+	// MorphOpen is erosion followed by dilation. Removes specks smaller than the structuring element.
+	MorphOpen
+	// MorphClose is dilation followed by erosion. Fills holes smaller than the structuring element.
+	MorphClose
+	// MorphTopHat is the difference between the image and its opening, leaving the specks removed by opening.
+	MorphTopHat
+	// MorphBlackTopHat is the difference between the closing of the image and the image, leaving the holes filled by closing.
+	MorphBlackTopHat
+	// MorphHitOrMiss sets pixels whose neighborhood matches set pixels of a hit element and clear pixels of a miss element.
+	MorphHitOrMiss
+)
+
+func (op MorphOp) String() string {
+	switch op {
+	case MorphErode:
+		return "Erode"
+	case MorphDilate:
+		return "Dilate"
+	case MorphOpen:
+		return "Open"
+	case MorphClose:
+		return "Close"
+	case MorphTopHat:
+		return "Top-hat"
+	case MorphBlackTopHat:
+		return "Black top-hat"
+	case MorphHitOrMiss:
+		return "Hit-or-miss"
+	default:
+		return "Unknown"
+	}
+}
+
+// StructuringElement is the neighborhood shape of a morphology operation.
+type StructuringElement struct {
+	// Points are the offsets of the element's pixels from the anchor pixel.
+	Points []image.Point
+	// rect is non-empty if Points are the points of rect so the element can be decomposed in two lines.
+	rect image.Rectangle
+}
+
+// RectElement returns a width by height rectangle element anchored at its center pixel (width/2, height/2).
+// Operations with rectangle elements are decomposed in a horizontal and a vertical line pass.
+func RectElement(width, height int) StructuringElement {
+	rect := image.Rect(-width/2, -height/2, width-width/2, height-height/2)
+	var se StructuringElement
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			se.Points = append(se.Points, image.Pt(x, y))
+		}
+	}
+	if width > 0 && height > 0 {
+		se.rect = rect
+	}
+	return se
+}
+
+// CrossElement returns a plus shaped element with arms of length radius.
+func CrossElement(radius int) StructuringElement {
+	se := StructuringElement{Points: []image.Point{{}}}
+	for i := 1; i <= radius; i++ {
+		se.Points = append(se.Points, image.Pt(-i, 0), image.Pt(i, 0), image.Pt(0, -i), image.Pt(0, i))
+	}
+	return se
+}
+
+// DiskElement returns the element of pixels within radius of the anchor.
+func DiskElement(radius int) StructuringElement {
+	var se StructuringElement
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if x*x+y*y <= radius*radius {
+				se.Points = append(se.Points, image.Pt(x, y))
+			}
+		}
+	}
+	return se
+}
+
+// bounds returns the largest horizontal and vertical offset magnitudes of the element.
+func (se StructuringElement) bounds() (rx, ry int) {
+	for _, p := range se.Points {
+		rx = max(rx, p.X, -p.X)
+		ry = max(ry, p.Y, -p.Y)
+	}
+	return rx, ry
+}
+
+func (se StructuringElement) reflect() StructuringElement {
+	r := StructuringElement{Points: make([]image.Point, len(se.Points))}
+	for i, p := range se.Points {
+		r.Points[i] = p.Mul(-1)
+	}
+	if !se.rect.Empty() {
+		r.rect = image.Rectangle{Min: se.rect.Max.Sub(image.Pt(1, 1)).Mul(-1), Max: se.rect.Min.Mul(-1).Add(image.Pt(1, 1))}
+	}
+	return r
+}
+
+// Morphology is a binary morphology filter operating on [pix.ShapeMonochrome] images. Rows are processed
+// 64 pixels at a time with word-wise bit operations on the packed rows.
+//
+// Pixels outside the image are considered set for erosion and clear for dilation, so objects touching the
+// image edge are not eroded from it. Pixels outside the ROI are read from the image. The ROI is
+// processed in memory, one bit per pixel, so in-place processing is supported.
+// Buffers are reused between calls so a Morphology must not be used by multiple goroutines concurrently.
+type Morphology struct {
+	op        MorphOp
+	se, miss  StructuringElement
+	ctrls     []pix.Control
+	scratches [3]bitImage
+}
+
+// NewMorphology creates a binary morphology filter applying op with structuring element se.
+// Use [NewHitOrMiss] for hit-or-miss transforms. The operation can be changed with the filter's control.
+func NewMorphology(op MorphOp, se StructuringElement) (*Morphology, error) {
+	if op < MorphErode || op >= MorphHitOrMiss {
+		return nil, errors.New("invalid morphology operation")
+	} else if len(se.Points) == 0 {
+		return nil, errors.New("empty structuring element")
+	}
+	m := &Morphology{op: op, se: se}
+	m.ctrls = []pix.Control{
+		&pix.ControlEnum[MorphOp]{
+			Name:        "Operation",
+			Description: "Morphology operation applied with the structuring element",
+			Value:       op,
+			ValidValues: []MorphOp{MorphErode, MorphDilate, MorphOpen, MorphClose, MorphTopHat, MorphBlackTopHat},
+			OnChange: func(op MorphOp) error {
+				m.op = op
+				return nil
+			},
+		},
+	}
+	return m, nil
+}
+
+// NewHitOrMiss creates a hit-or-miss transform which sets pixels where all hit element pixels are set
+// and all miss element pixels are clear. It is used to find patterns such as corners, endpoints or isolated pixels.
+func NewHitOrMiss(hit, miss StructuringElement) (*Morphology, error) {
+	if len(hit.Points) == 0 && len(miss.Points) == 0 {
+		return nil, errors.New("empty structuring elements")
+	}
+	return &Morphology{op: MorphHitOrMiss, se: hit, miss: miss}, nil
+}
+
+// ShapeIO implements [pix.Filter].
+func (m *Morphology) ShapeIO() (output, input pix.Shape) {
+	return pix.ShapeMonochrome, pix.ShapeMonochrome
+}
+
+// Controls implements [pix.Filter].
+func (m *Morphology) Controls() []pix.Control {
+	return m.ctrls
+}
+
+// apron returns the number of pixels around the ROI that affect the output.
+func (m *Morphology) apron() (ax, ay int) {
+	ax, ay = m.se.bounds()
+	switch m.op {
+	case MorphOpen, MorphClose, MorphTopHat, MorphBlackTopHat:
+		ax, ay = 2*ax, 2*ay
+	case MorphHitOrMiss:
+		mx, my := m.miss.bounds()
+		ax, ay = max(ax, mx), max(ay, my)
+	}
+	return ax, ay
+}
+
+// Process implements [pix.Filter].
+func (m *Morphology) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	if src.Dims().Shape != pix.ShapeMonochrome {
+		return pix.Dims{}, errShapeMismatch
+	}
+	inPlace := dst == nil
+	dst, srcDims, err := pix.ValidateProcessArgs(dst, pix.Dims{Shape: pix.ShapeMonochrome}, src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	bounds := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	r := bounds
+	if roi != nil {
+		r = *roi
+	}
+	dstDims := pix.Dims{Width: r.Dx(), Height: r.Dy(), Shape: pix.ShapeMonochrome}
+	dstDims.Stride = dstDims.SizeRow()
+	dstOff, dstBitOff := 0, 0
+	if inPlace {
+		dstDims.Stride = srcDims.Stride
+		dstOff, dstBitOff = r.Min.Y*srcDims.Stride, r.Min.X
+	} else if int64(len(dst)) < dstDims.Size() {
+		return pix.Dims{}, errors.New("destination buffer not large enough to store output")
+	}
+
+	ax, ay := m.apron()
+	ex := image.Rect(r.Min.X-ax, r.Min.Y-ay, r.Max.X+ax, r.Max.Y+ay).Intersect(bounds)
+	a, b, c := &m.scratches[0], &m.scratches[1], &m.scratches[2]
+	a.resize(ex.Dx(), ex.Dy())
+	b.resize(ex.Dx(), ex.Dy())
+	row := make([]byte, (ex.Dx()+7)/8)
+	rowBuf := make([]byte, srcDims.SizeRow())
+	for y := ex.Min.Y; y < ex.Max.Y; y++ {
+		srcRow, err := pix.ImageRow(rowBuf, src, y)
+		if err != nil {
+			return pix.Dims{}, err
+		}
+		pix.CopyBits(row, 0, srcRow, ex.Min.X, ex.Dx())
+		a.setRow(y-ex.Min.Y, row)
+	}
+	// Pixels outside the image are outside the loaded region so
+	// only edges of the loaded region that are image edges need the border convention.
+	// Edges inside the image are farther than the apron from the ROI and do not affect the output.
+	var out *bitImage
+	switch m.op {
+	case MorphErode:
+		a.morph(b, m.se, true)
+		out = b
+	case MorphDilate:
+		a.morph(b, m.se.reflect(), false)
+		out = b
+	case MorphOpen, MorphTopHat:
+		c.resize(ex.Dx(), ex.Dy())
+		a.morph(b, m.se, true)
+		b.morph(c, m.se.reflect(), false)
+		out = c
+		if m.op == MorphTopHat {
+			for i := range c.words {
+				c.words[i] = a.words[i] &^ c.words[i]
+			}
+		}
+	case MorphClose, MorphBlackTopHat:
+		c.resize(ex.Dx(), ex.Dy())
+		a.morph(b, m.se.reflect(), false)
+		b.morph(c, m.se, true)
+		out = c
+		if m.op == MorphBlackTopHat {
+			for i := range c.words {
+				c.words[i] &^= a.words[i]
+			}
+		}
+	case MorphHitOrMiss:
+		c.resize(ex.Dx(), ex.Dy())
+		a.morph(b, m.se, true)
+		for i := range a.words {
+			a.words[i] = ^a.words[i]
+		}
+		a.morph(c, m.miss, true)
+		for i := range c.words {
+			c.words[i] &= b.words[i]
+		}
+		out = c
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		out.getRow(row, y-ex.Min.Y)
+		pix.CopyBits(dst[dstOff+(y-r.Min.Y)*dstDims.Stride:], dstBitOff, row, r.Min.X-ex.Min.X, r.Dx())
+	}
+	return dstDims, nil
+}
+
+// bitImage is a monochrome image stored in 64-bit words. Pixel x of a row is bit 63-x%64 of word x/64.
+type bitImage struct {
+	width, height int
+	wordsPerRow   int
+	words         []uint64
+}
+
+func (b *bitImage) resize(width, height int) {
+	b.width, b.height = width, height
+	b.wordsPerRow = (width + 63) / 64
+	n := b.wordsPerRow * height
+	if cap(b.words) < n {
+		b.words = make([]uint64, n)
+	}
+	b.words = b.words[:n]
+}
+
+func (b *bitImage) row(y int) []uint64 {
+	return b.words[y*b.wordsPerRow : (y+1)*b.wordsPerRow]
+}
+
+// setRow sets row y from packed monochrome bytes.
+func (b *bitImage) setRow(y int, packed []byte) {
+	var buf [8]byte
+	for k := range b.row(y) {
+		n := copy(buf[:], packed[min(8*k, len(packed)):])
+		clear(buf[n:])
+		b.words[y*b.wordsPerRow+k] = binary.BigEndian.Uint64(buf[:])
+	}
+}
+
+// getRow stores row y as packed monochrome bytes in packed.
+func (b *bitImage) getRow(packed []byte, y int) {
+	var buf [8]byte
+	for k, w := range b.row(y) {
+		binary.BigEndian.PutUint64(buf[:], w)
+		copy(packed[min(8*k, len(packed)):], buf[:])
+	}
+}
+
+// setTail sets the padding bits after the last pixel of every row to outside.
+func (b *bitImage) setTail(outside uint64) {
+	pad := uint(b.wordsPerRow*64 - b.width)
+	if pad == 0 {
+		return
+	}
+	mask := uint64(1)<<pad - 1
+	for y := 0; y < b.height; y++ {
+		i := (y+1)*b.wordsPerRow - 1
+		b.words[i] = b.words[i]&^mask | outside&mask
+	}
+}
+
+// shiftedWord returns word k of row shifted so bit x holds pixel x+dx of row. Pixels beyond the row are outside.
+func shiftedWord(row []uint64, k, dx int, outside uint64) uint64 {
+	q, s := dx>>6, uint(dx&63) // Floor division.
+	i := k + q
+	if s == 0 {
+		return wordAt(row, i, outside)
+	}
+	return wordAt(row, i, outside)<<s | wordAt(row, i+1, outside)>>(64-s)
+}
+
+func wordAt(row []uint64, i int, outside uint64) uint64 {
+	if i < 0 || i >= len(row) {
+		return outside
+	}
+	return row[i]
+}
+
+// morph stores in dst the erosion (AND) or dilation (OR) of b over the points of se:
+// dst(x,y) = op over p of b(x+p.X, y+p.Y). Pixels outside b are set for erosion and clear for dilation.
+func (b *bitImage) morph(dst *bitImage, se StructuringElement, erode bool) {
+	if !se.rect.Empty() && se.rect.Dx() > 1 && se.rect.Dy() > 1 {
+		// Decompose rectangle in a horizontal and a vertical line.
+		var tmp bitImage
+		tmp.resize(b.width, b.height)
+		var h, v StructuringElement
+		for x := se.rect.Min.X; x < se.rect.Max.X; x++ {
+			h.Points = append(h.Points, image.Pt(x, 0))
+		}
+		for y := se.rect.Min.Y; y < se.rect.Max.Y; y++ {
+			v.Points = append(v.Points, image.Pt(0, y))
+		}
+		b.morph(&tmp, h, erode)
+		tmp.morph(dst, v, erode)
+		return
+	}
+	var outside uint64
+	if erode {
+		outside = ^outside
+	}
+	b.setTail(outside)
+	for y := 0; y < b.height; y++ {
+		out := dst.row(y)
+		for k := range out {
+			out[k] = outside
+		}
+		for _, p := range se.Points {
+			sy := y + p.Y
+			if sy < 0 || sy >= b.height {
+				continue // Outside pixels are the identity of the operation.
+			}
+			src := b.row(sy)
+			for k := range out {
+				w := shiftedWord(src, k, p.X, outside)
+				if erode {
+					out[k] &= w
+				} else {
+					out[k] |= w
+				}
+			}
+		}
+	}
+}
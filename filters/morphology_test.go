@@ -0,0 +1,158 @@
+package filters
+
+import (
+	"image"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+// naiveMorph is the per-pixel reference of erosion and dilation over a w by h bool image.
+func naiveMorph(src []bool, w, h int, points []image.Point, erode bool) []bool {
+	dst := make([]bool, len(src))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := erode
+			for _, p := range points {
+				if !erode {
+					p = p.Mul(-1)
+				}
+				sx, sy := x+p.X, y+p.Y
+				s := erode // Outside value.
+				if sx >= 0 && sx < w && sy >= 0 && sy < h {
+					s = src[sy*w+sx]
+				}
+				if erode {
+					v = v && s
+				} else {
+					v = v || s
+				}
+			}
+			dst[y*w+x] = v
+		}
+	}
+	return dst
+}
+
+func naiveMorphOp(src []bool, w, h int, op MorphOp, se, miss StructuringElement) []bool {
+	erode := func(img []bool, se StructuringElement) []bool { return naiveMorph(img, w, h, se.Points, true) }
+	dilate := func(img []bool, se StructuringElement) []bool { return naiveMorph(img, w, h, se.Points, false) }
+	var out []bool
+	switch op {
+	case MorphErode:
+		return erode(src, se)
+	case MorphDilate:
+		return dilate(src, se)
+	case MorphOpen, MorphTopHat:
+		out = dilate(erode(src, se), se)
+		if op == MorphTopHat {
+			for i := range out {
+				out[i] = src[i] && !out[i]
+			}
+		}
+	case MorphClose, MorphBlackTopHat:
+		out = erode(dilate(src, se), se)
+		if op == MorphBlackTopHat {
+			for i := range out {
+				out[i] = out[i] && !src[i]
+			}
+		}
+	case MorphHitOrMiss:
+		not := make([]bool, len(src))
+		for i := range src {
+			not[i] = !src[i]
+		}
+		out = erode(src, se)
+		missed := erode(not, miss)
+		for i := range out {
+			out[i] = out[i] && missed[i]
+		}
+	}
+	return out
+}
+
+func TestMorphology(t *testing.T) {
+	const width, height = 75, 13 // Rows span two words.
+	img := newRandomImage(newRand(), width, height, pix.ShapeMonochrome)
+	stride := img.dims.Stride
+	src := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			src[y*width+x] = monochromeAt(img.buf, stride, x, y)
+		}
+	}
+	elements := map[string]StructuringElement{
+		"rect5x3": RectElement(5, 3),
+		"rect4x4": RectElement(4, 4),
+		"cross2":  CrossElement(2),
+		"disk3":   DiskElement(3),
+		"line70":  RectElement(70, 1),
+	}
+	rois := []image.Rectangle{image.Rect(0, 0, width, height), image.Rect(3, 2, 71, 11)}
+	for name, se := range elements {
+		for op := MorphErode; op <= MorphHitOrMiss; op++ {
+			var f *Morphology
+			var err error
+			miss := CrossElement(1)
+			if op == MorphHitOrMiss {
+				f, err = NewHitOrMiss(se, miss)
+			} else {
+				f, err = NewMorphology(op, se)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := naiveMorphOp(src, width, height, op, se, miss)
+			for _, rect := range rois {
+				got := processFilter(t, f, readerImage{img}, &rect)
+				gotStride := (rect.Dx() + 7) / 8
+				for y := rect.Min.Y; y < rect.Max.Y; y++ {
+					for x := rect.Min.X; x < rect.Max.X; x++ {
+						if monochromeAt(got, gotStride, x-rect.Min.X, y-rect.Min.Y) != want[y*width+x] {
+							t.Fatalf("%s %s %v: pixel (%d,%d) mismatch", name, op, rect, x, y)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMorphologyInPlace(t *testing.T) {
+	img := newRandomImage(newRand(), 40, 10, pix.ShapeMonochrome)
+	f, err := NewMorphology(MorphClose, DiskElement(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rect := image.Rect(5, 1, 33, 9)
+	want := processFilter(t, f, img, &rect)
+	original := append([]byte(nil), img.buf...)
+	_, err = f.Process(nil, img, &rect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 40; x++ {
+			p := image.Pt(x, y)
+			wantBit := monochromeAt(original, img.dims.Stride, x, y)
+			if p.In(rect) {
+				wantBit = monochromeAt(want, (rect.Dx()+7)/8, x-rect.Min.X, y-rect.Min.Y)
+			}
+			if monochromeAt(img.buf, img.dims.Stride, x, y) != wantBit {
+				t.Fatalf("pixel %v mismatch", p)
+			}
+		}
+	}
+}
+
+func BenchmarkMorphologyErode(b *testing.B) {
+	img := newRandomImage(newRand(), 640, 480, pix.ShapeMonochrome)
+	f, err := NewMorphology(MorphErode, RectElement(5, 5))
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := make([]byte, img.dims.Size())
+	for b.Loop() {
+		f.Process(dst, img, nil)
+	}
+}
@@ -0,0 +1,385 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/soypat/pix"
+)
+
+// BorderMode selects how pixels outside the source image are synthesized
+// for neighborhood filters.
+type BorderMode int
+
+const (
+	// BorderClamp repeats the nearest edge pixel: aaa|abcd|ddd.
+	BorderClamp BorderMode = iota
+	// BorderMirror reflects pixels about the edge pixel without repeating it: cb|abcd|cb.
+	BorderMirror
+	// BorderWrap tiles the image: bcd|abcd|abc.
+	BorderWrap
+	// BorderConstant uses a fixed fill color: ff|abcd|ff.
+	BorderConstant
+)
+
+func (b BorderMode) String() string {
+	switch b {
+	case BorderClamp:
+		return "Clamp"
+	case BorderMirror:
+		return "Mirror"
+	case BorderWrap:
+		return "Wrap"
+	case BorderConstant:
+		return "Constant"
+	default:
+		return "Unknown"
+	}
+}
+
+// borderIndex maps index i to [0,n) according to mode. Returns -1 for constant border.
+func borderIndex(i, n int, mode BorderMode) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	switch mode {
+	case BorderClamp:
+		return min(max(i, 0), n-1)
+	case BorderMirror:
+		if n == 1 {
+			return 0
+		}
+		period := 2*n - 2
+		i = (i%period + period) % period
+		if i >= n {
+			i = period - i
+		}
+		return i
+	case BorderWrap:
+		return (i%n + n) % n
+	}
+	return -1
+}
+
+// Window gives access to the source pixels around a row of output pixels.
+// Rows of the window are padded with Radius pixels on each side so all
+// neighbors of output pixels are available regardless of image edges.
+type Window struct {
+	// Y is the index of the output row within the processed region.
+	Y int
+	// Width is the number of output pixels in the row.
+	Width int
+	// Radius is the number of neighbor rows and columns on each side of the center pixel.
+	Radius int
+	// BytesPerPixel of the input shape. Pixels of Grayscale2bit and Monochrome inputs
+	// are unpacked to one byte per pixel Grayscale8bit samples so BytesPerPixel is 1.
+	BytesPerPixel int
+	// State is available to the callback to carry state from one row to the next,
+	// such as running sums. It is nil on the first row of every band and rows
+	// of a band are processed in order, so Y is the previous row's Y plus one when State is not nil.
+	State any
+	rows  [][]byte
+}
+
+// Row returns the padded source row at vertical offset dy from the output row, where -Radius <= dy <= Radius.
+// The neighbor at horizontal offset dx of output pixel x starts at byte (x+dx+Radius)*BytesPerPixel.
+func (w *Window) Row(dy int) []byte {
+	return w.rows[dy+w.Radius]
+}
+
+// At returns the bytes of the source pixel at offset (dx,dy) from output pixel x.
+func (w *Window) At(x, dx, dy int) []byte {
+	i := (x + dx + w.Radius) * w.BytesPerPixel
+	return w.rows[dy+w.Radius][i : i+w.BytesPerPixel]
+}
+
+// NeighborhoodFunc computes a row of output pixels from the window of source pixels around it.
+// dst contains win.Width pixels worth of bytes. For Grayscale2bit and Monochrome outputs dst holds
+// one Grayscale8bit byte per pixel which is packed to the output shape after the call.
+type NeighborhoodFunc func(dst []byte, win *Window)
+
+// NeighborhoodFilter computes each output pixel from the source pixels within Radius of it,
+// which is the base of blurs, sharpening and edge detection. It keeps a rolling window of
+// 2*Radius+1 padded source rows so memory usage is independent of image height.
+//
+// Neighbors outside the ROI are read from the source image when they exist so
+// processing a ROI yields the same pixels as processing the whole image. Neighbors outside the image
+// are synthesized according to Border. The input shape must have a whole number of bytes per pixel
+// or be one of the sub-byte grayscale shapes Grayscale2bit and Monochrome, which are unpacked
+// to Grayscale8bit so Fn sees the same window layout as for Grayscale8bit input.
+//
+// In-place processing is supported and always processes rows serially.
+type NeighborhoodFilter struct {
+	In  pix.Shape
+	Out pix.Shape
+	// Radius is the number of neighbor rows and columns available on each side of a pixel.
+	Radius int
+	Border BorderMode
+	// Fill is the color of pixels outside the image for [BorderConstant].
+	Fill  color.RGBA64
+	Fn    NeighborhoodFunc
+	Ctrls []pix.Control // User-defined controls for this filter.
+	// Workers is the number of goroutines that process bands of rows concurrently.
+	// Fn must be safe for concurrent use when Workers is greater than 1.
+	Workers int
+}
+
+// ShapeIO implements [Filter].
+func (f *NeighborhoodFilter) ShapeIO() (output, input pix.Shape) {
+	return f.Out, f.In
+}
+
+// Controls implements [Filter].
+func (f *NeighborhoodFilter) Controls() []pix.Control {
+	return f.Ctrls
+}
+
+// Process implements [Filter].
+func (f *NeighborhoodFilter) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	job, err := f.job(src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	return job.process(dst)
+}
+
+// ProcessContext implements [pix.ContextFilter]. ctx is checked before processing each row.
+func (f *NeighborhoodFilter) ProcessContext(ctx context.Context, dst []byte, src pix.Image, roi *image.Rectangle, progress pix.ProgressFunc) (pix.Dims, error) {
+	job, err := f.job(src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	job.ctx, job.progress = ctx, progress
+	return job.process(dst)
+}
+
+// ProcessTo implements [pix.StreamFilter]. Memory usage is bounded to the window rows.
+func (f *NeighborhoodFilter) ProcessTo(dst pix.ImageWriter, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	job, err := f.job(src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	return job.processTo(dst)
+}
+
+// ProcessRows implements [pix.RowProcessor] so the filter can back a [pix.LazyImage].
+func (f *NeighborhoodFilter) ProcessRows(dst []byte, stride int, src pix.Image, roi *image.Rectangle, y0, y1 int) error {
+	job, err := f.job(src, roi)
+	if err != nil {
+		return err
+	}
+	return job.processRows(dst, stride, y0, y1)
+}
+
+func (f *NeighborhoodFilter) job(src pix.Image, roi *image.Rectangle) (*rowJob, error) {
+	if f.Fn == nil {
+		return nil, errNilPixelFunc
+	}
+	fill, err := neighborhoodFill(f.In, f.Radius, f.Border, f.Fill)
+	if err != nil {
+		return nil, err
+	}
+	wfn := f.Fn
+	if subByteGray(f.Out) {
+		wfn = packGray(f.Out, f.Fn)
+	}
+	return &rowJob{
+		src:     src,
+		roi:     roi,
+		out:     f.Out,
+		in:      f.In,
+		wfn:     wfn,
+		radius:  f.Radius,
+		border:  f.Border,
+		fill:    fill,
+		workers: f.Workers,
+	}, nil
+}
+
+// subByteGray reports whether sh is a grayscale shape with several pixels per byte,
+// which neighborhood filters unpack to Grayscale8bit.
+func subByteGray(sh pix.Shape) bool {
+	return sh == pix.ShapeGrayscale2bit || sh == pix.ShapeMonochrome
+}
+
+// packGray wraps fn so it writes Grayscale8bit pixels to a scratch row which is then packed to out.
+func packGray(out pix.Shape, fn NeighborhoodFunc) NeighborhoodFunc {
+	codec, _ := out.Codec()
+	// Scratch rows are pooled so the function may be called concurrently.
+	var pool sync.Pool
+	return func(dst []byte, win *Window) {
+		row, _ := pool.Get().(*[]byte)
+		if row == nil {
+			row = new([]byte)
+		}
+		*row = slices.Grow((*row)[:0], win.Width)[:win.Width]
+		fn(*row, win)
+		for x, v := range *row {
+			y := uint16(v) * 0x101
+			codec.Encode(dst, x, color.RGBA64{R: y, G: y, B: y, A: 0xffff})
+		}
+		pool.Put(row)
+	}
+}
+
+// neighborhoodFill validates neighborhood parameters and returns fill encoded in the input shape,
+// or as Grayscale8bit for sub-byte grayscale input.
+func neighborhoodFill(in pix.Shape, radius int, border BorderMode, fill color.RGBA64) ([]byte, error) {
+	if subByteGray(in) {
+		in = pix.ShapeGrayscale8bit
+	}
+	bits := in.BitsPerPixel()
+	if bits < 8 || bits%8 != 0 {
+		return nil, errors.New("neighborhood filter input shape must have whole bytes per pixel")
+	} else if radius < 0 {
+		return nil, errors.New("negative neighborhood radius")
+	} else if border < BorderClamp || border > BorderConstant {
+		return nil, errors.New("invalid border mode")
+	}
+	codec, ok := in.Codec()
+	if !ok {
+		return nil, errors.New("no codec for input shape")
+	}
+	pixel := make([]byte, bits/8)
+	codec.Encode(pixel, 0, fill)
+	return pixel, nil
+}
+
+// windowBand yields a window around each row of region r in order. y is relative to r.
+func (job *rowJob) windowBand(srcDims pix.Dims, r image.Rectangle, yield rowSink) error {
+	const notLoaded = math.MinInt
+	bits := job.in.BitsPerPixel()
+	bpp := bits / 8
+	unpack := subByteGray(job.in)
+	if unpack {
+		bpp = 1
+	}
+	radius := job.radius
+	n := 2*radius + 1
+	padStart := r.Min.X - radius // Source column of first padded pixel.
+	paddedWidth := r.Dx() + 2*radius
+	rowBytes := paddedWidth * bpp
+	win := &Window{Width: r.Dx(), Radius: radius, BytesPerPixel: bpp, rows: make([][]byte, n)}
+	storage := make([]byte, n*rowBytes)
+	loaded := make([]int, n) // Source row held by each window row, -1 for constant border.
+	for i := range win.rows {
+		win.rows[i] = storage[i*rowBytes : (i+1)*rowBytes]
+		loaded[i] = notLoaded
+	}
+	var srcBuf []byte
+	if buffered, ok := job.src.(pix.ImageBuffered); ok {
+		srcBuf = buffered.Buffer()
+	}
+	// Span of source columns read for each row.
+	x0, x1 := max(0, padStart), min(srcDims.Width, r.Max.X+radius)
+	if job.border == BorderWrap {
+		x0, x1 = 0, srcDims.Width
+	}
+	// Bytes of each source row holding columns x0 to x1.
+	byte0, byte1 := x0*bits/8, (x1*bits+7)/8
+	var readBuf, unpackBuf []byte
+	if srcBuf == nil {
+		readBuf = make([]byte, byte1-byte0)
+	}
+	codec, _ := job.in.Codec()
+	if unpack {
+		unpackBuf = make([]byte, x1-x0)
+	}
+	// Rows at the top of the image are overwritten by in-place processing
+	// before they are needed again by wrapped rows at the bottom.
+	var stash map[int][]byte
+	if job.border == BorderWrap {
+		stash = make(map[int][]byte)
+	}
+
+	load := func(i, y int) error {
+		m := borderIndex(y, srcDims.Height, job.border)
+		if loaded[i] == m {
+			return nil
+		}
+		dst := win.rows[i]
+		loaded[i] = m
+		// Reusing rows already in the window saves reads and is required for
+		// in-place processing since the source row may have been overwritten.
+		for j, row := range win.rows {
+			if j != i && loaded[j] == m {
+				copy(dst, row)
+				return nil
+			}
+		}
+		if row, ok := stash[m]; ok {
+			copy(dst, row)
+			return nil
+		}
+		if m < 0 {
+			for px := 0; px < paddedWidth; px++ {
+				copy(dst[px*bpp:], job.fill)
+			}
+			return nil
+		}
+		var src []byte
+		off := m*srcDims.Stride + byte0
+		if srcBuf != nil {
+			src = srcBuf[off : off+byte1-byte0]
+		} else {
+			_, err := job.src.ReadAt(readBuf, int64(off))
+			if err != nil {
+				return err
+			}
+			src = readBuf
+		}
+		if unpack {
+			// Pixel x0 is not necessarily the first pixel of byte0.
+			first := byte0 * 8 / bits
+			for i := range unpackBuf {
+				unpackBuf[i] = byte(codec.Decode(src, x0+i-first).R >> 8)
+			}
+			src = unpackBuf
+		}
+		// src holds source columns x0 to x1.
+		lead := max(0, x0-padStart)
+		copy(dst[lead*bpp:], src[(padStart+lead-x0)*bpp:])
+		for px := 0; px < paddedWidth; px++ {
+			x := padStart + px
+			if x >= 0 && x < srcDims.Width {
+				continue
+			}
+			pixel := job.fill
+			if sx := borderIndex(x, srcDims.Width, job.border); sx >= 0 {
+				pixel = src[(sx-x0)*bpp : (sx-x0+1)*bpp]
+			}
+			copy(dst[px*bpp:], pixel)
+		}
+		if stash != nil && m < radius {
+			stash[m] = append([]byte(nil), dst...)
+		}
+		return nil
+	}
+
+	for i := range n {
+		if err := load(i, r.Min.Y-radius+i); err != nil {
+			return err
+		}
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		if y > r.Min.Y {
+			// Slide window down one row recycling the top row.
+			top, topLoaded := win.rows[0], loaded[0]
+			copy(win.rows, win.rows[1:])
+			copy(loaded, loaded[1:])
+			win.rows[n-1], loaded[n-1] = top, topLoaded
+			if err := load(n-1, y+radius); err != nil {
+				return err
+			}
+		}
+		if err := yield(y-r.Min.Y, nil, win); err != nil {
+			return err
+		}
+	}
+	return nil
+}
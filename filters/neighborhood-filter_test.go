@@ -0,0 +1,158 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+// newHashNeighborhood returns a filter whose output depends on the position of every neighbor.
+func newHashNeighborhood(shape pix.Shape, radius int, border BorderMode) *NeighborhoodFilter {
+	return &NeighborhoodFilter{
+		In:     shape,
+		Out:    shape,
+		Radius: radius,
+		Border: border,
+		Fill:   color.RGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 0xffff},
+		Fn: func(dst []byte, win *Window) {
+			bpp := win.BytesPerPixel
+			for x := 0; x < win.Width; x++ {
+				for c := 0; c < bpp; c++ {
+					var h byte
+					for dy := -win.Radius; dy <= win.Radius; dy++ {
+						for dx := -win.Radius; dx <= win.Radius; dx++ {
+							h = h*31 + win.At(x, dx, dy)[c]
+						}
+					}
+					dst[x*bpp+c] = h
+				}
+			}
+		},
+	}
+}
+
+// hashNeighborhoodRef is the reference implementation of newHashNeighborhood over roi.
+func hashNeighborhoodRef(img *testImage, f *NeighborhoodFilter, r image.Rectangle) []byte {
+	d := img.dims
+	bpp := d.Shape.BitsPerPixel() / 8
+	fill := make([]byte, bpp)
+	codec, _ := d.Shape.Codec()
+	codec.Encode(fill, 0, f.Fill)
+	out := make([]byte, r.Dx()*r.Dy()*bpp)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for c := 0; c < bpp; c++ {
+				var h byte
+				for dy := -f.Radius; dy <= f.Radius; dy++ {
+					for dx := -f.Radius; dx <= f.Radius; dx++ {
+						sx := borderIndex(x+dx, d.Width, f.Border)
+						sy := borderIndex(y+dy, d.Height, f.Border)
+						v := fill[c]
+						if sx >= 0 && sy >= 0 {
+							v = img.buf[sy*d.Stride+sx*bpp+c]
+						}
+						h = h*31 + v
+					}
+				}
+				out[((y-r.Min.Y)*r.Dx()+x-r.Min.X)*bpp+c] = h
+			}
+		}
+	}
+	return out
+}
+
+func TestBorderIndex(t *testing.T) {
+	tests := []struct {
+		mode BorderMode
+		want []int // For indices -3 to 6 over n=4.
+	}{
+		{BorderClamp, []int{0, 0, 0, 0, 1, 2, 3, 3, 3, 3}},
+		{BorderMirror, []int{3, 2, 1, 0, 1, 2, 3, 2, 1, 0}},
+		{BorderWrap, []int{1, 2, 3, 0, 1, 2, 3, 0, 1, 2}},
+		{BorderConstant, []int{-1, -1, -1, 0, 1, 2, 3, -1, -1, -1}},
+	}
+	for _, test := range tests {
+		for i, want := range test.want {
+			if got := borderIndex(i-3, 4, test.mode); got != want {
+				t.Errorf("%s: borderIndex(%d, 4) got %d, want %d", test.mode, i-3, got, want)
+			}
+		}
+	}
+}
+
+func TestNeighborhoodFilter(t *testing.T) {
+	const width, height = 13, 11
+	rois := []image.Rectangle{image.Rect(0, 0, width, height), image.Rect(3, 2, 9, 10), image.Rect(0, 8, 5, 11)}
+	for _, shape := range []pix.Shape{pix.ShapeGrayscale8bit, pix.ShapeRGB888} {
+		for _, border := range []BorderMode{BorderClamp, BorderMirror, BorderWrap, BorderConstant} {
+			for _, radius := range []int{0, 1, 3} {
+				for _, rect := range rois {
+					img := newRandomImage(newRand(), width, height, shape)
+					f := newHashNeighborhood(shape, radius, border)
+					want := hashNeighborhoodRef(img, f, rect)
+					bpp := shape.BitsPerPixel() / 8
+					name := func(mode string) string {
+						return mode + " " + border.String() + " " + rect.String()
+					}
+
+					got := make([]byte, len(want))
+					_, err := f.Process(got, readerImage{img}, &rect)
+					if err != nil {
+						t.Fatal(err)
+					} else if !bytes.Equal(got, want) {
+						t.Errorf("%s radius %d: mismatch", name("ReadAt"), radius)
+					}
+
+					f.Workers = 3
+					clear(got)
+					_, err = f.Process(got, img, &rect)
+					if err != nil {
+						t.Fatal(err)
+					} else if !bytes.Equal(got, want) {
+						t.Errorf("%s radius %d: mismatch", name("parallel"), radius)
+					}
+
+					_, err = f.Process(nil, img, &rect)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for y := rect.Min.Y; y < rect.Max.Y; y++ {
+						off := y*img.dims.Stride + rect.Min.X*bpp
+						wantRow := want[(y-rect.Min.Y)*rect.Dx()*bpp:][:rect.Dx()*bpp]
+						if !bytes.Equal(img.buf[off:off+len(wantRow)], wantRow) {
+							t.Errorf("%s radius %d: row %d mismatch", name("in-place"), radius, y)
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNeighborhoodFilterLazyImage(t *testing.T) {
+	const width, height = 9, 12
+	img := newRandomImage(newRand(), width, height, pix.ShapeGrayscale8bit)
+	f := newHashNeighborhood(pix.ShapeGrayscale8bit, 2, BorderMirror)
+	rect := image.Rect(1, 1, 8, 11)
+	want := hashNeighborhoodRef(img, f, rect)
+	lazy, err := pix.NewLazyImage(f, img, &rect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read rows bottom to top so each band is computed out of order.
+	stride := lazy.Dims().Stride
+	got := make([]byte, len(want))
+	for y := rect.Dy() - 1; y >= 0; y-- {
+		_, err = lazy.ReadAt(got[y*stride:(y+1)*stride], int64(y*stride))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("lazy neighborhood output mismatch")
+	}
+}
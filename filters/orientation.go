@@ -0,0 +1,417 @@
+package filters
+
+import (
+	"errors"
+	"image"
+
+	"github.com/soypat/pix"
+)
+
+// Orientation is a lossless rotation or mirroring of an image. Rotations are clockwise.
+type Orientation int
+
+const (
+	// OrientNone leaves the image unchanged.
+	OrientNone Orientation = iota
+	// OrientRotate90 rotates the image 90 degrees clockwise. Width and height are swapped.
+	OrientRotate90
+	// OrientRotate180 rotates the image 180 degrees.
+	OrientRotate180
+	// OrientRotate270 rotates the image 270 degrees clockwise, or 90 degrees counter-clockwise. Width and height are swapped.
+	OrientRotate270
+	// OrientFlipHorizontal mirrors the image left to right.
+	OrientFlipHorizontal
+	// OrientFlipVertical mirrors the image top to bottom.
+	OrientFlipVertical
+	// OrientTranspose mirrors the image across its main diagonal so rows become columns. Width and height are swapped.
+	OrientTranspose
+	// OrientTransverse mirrors the image across its anti-diagonal. Width and height are swapped.
+	OrientTransverse
+)
+
+func (o Orientation) String() string {
+	switch o {
+	case OrientNone:
+		return "None"
+	case OrientRotate90:
+		return "Rotate 90°"
+	case OrientRotate180:
+		return "Rotate 180°"
+	case OrientRotate270:
+		return "Rotate 270°"
+	case OrientFlipHorizontal:
+		return "Flip horizontal"
+	case OrientFlipVertical:
+		return "Flip vertical"
+	case OrientTranspose:
+		return "Transpose"
+	case OrientTransverse:
+		return "Transverse"
+	default:
+		return "Unknown"
+	}
+}
+
+// Swapped reports whether the orientation swaps the width and height of the image.
+func (o Orientation) Swapped() bool {
+	return o == OrientRotate90 || o == OrientRotate270 || o == OrientTranspose || o == OrientTransverse
+}
+
+// mirrors reports whether output x and output y run opposite to the source axis they are read from.
+func (o Orientation) mirrors() (mx, my bool) {
+	switch o {
+	case OrientRotate90:
+		return true, false
+	case OrientRotate180:
+		return true, true
+	case OrientRotate270:
+		return false, true
+	case OrientFlipHorizontal:
+		return true, false
+	case OrientFlipVertical:
+		return false, true
+	case OrientTransverse:
+		return true, true
+	}
+	return false, false
+}
+
+// orientTile is the height in rows of the source bands read by orientations swapping width and height.
+// A band of source rows fills a tile of orientTile pixels of every output row.
+const orientTile = 64
+
+// Orient is a filter which rotates or mirrors images losslessly. It supports all shapes, including sub-byte
+// shapes and ROIs not aligned to bytes, by copying pixels bit by bit.
+//
+// Orientations that swap width and height read the source in bands of rows with a single ReadAt
+// call per band and transpose each band into a tile of the output. Orientations that preserve
+// width and height, see [Orientation.Swapped], stream rows and support in-place processing.
+type Orient struct {
+	shape pix.Shape
+	o     Orientation
+	ctrls []pix.Control
+}
+
+var (
+	_ pix.DimsFilter   = (*Orient)(nil)
+	_ pix.RowProcessor = (*Orient)(nil)
+	_ pix.StreamFilter = (*Orient)(nil)
+)
+
+// NewOrient creates a filter applying orientation o to images of the given shape.
+// The orientation can be changed with the filter's control.
+func NewOrient(shape pix.Shape, o Orientation) (*Orient, error) {
+	if shape.BitsPerPixel() < 1 {
+		return nil, errors.New("invalid shape")
+	} else if o < OrientNone || o > OrientTransverse {
+		return nil, errors.New("invalid orientation")
+	}
+	f := &Orient{shape: shape, o: o}
+	f.ctrls = []pix.Control{
+		&pix.ControlEnum[Orientation]{
+			Name:        "Orientation",
+			Description: "Rotation or mirroring applied to the image",
+			Value:       o,
+			ValidValues: []Orientation{OrientNone, OrientRotate90, OrientRotate180, OrientRotate270, OrientFlipHorizontal, OrientFlipVertical, OrientTranspose, OrientTransverse},
+			OnChange: func(o Orientation) error {
+				f.o = o
+				return nil
+			},
+		},
+	}
+	return f, nil
+}
+
+// ShapeIO implements [pix.Filter].
+func (f *Orient) ShapeIO() (output, input pix.Shape) {
+	return f.shape, f.shape
+}
+
+// Controls implements [pix.Filter].
+func (f *Orient) Controls() []pix.Control {
+	return f.ctrls
+}
+
+// OutputDims implements [pix.DimsFilter].
+func (f *Orient) OutputDims(src pix.Dims, roi *image.Rectangle) (pix.Dims, error) {
+	if src.Shape != f.shape {
+		return pix.Dims{}, errShapeMismatch
+	}
+	d := pix.Dims{Width: src.Width, Height: src.Height, Shape: f.shape}
+	if roi != nil {
+		d.Width, d.Height = roi.Dx(), roi.Dy()
+	}
+	if f.o.Swapped() {
+		d.Width, d.Height = d.Height, d.Width
+	}
+	d.Stride = d.SizeRow()
+	return d, d.Validate()
+}
+
+// Process implements [pix.Filter]. In-place processing is supported by orientations which preserve width and height.
+func (f *Orient) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	inPlace := dst == nil
+	if inPlace && f.o.Swapped() {
+		return pix.Dims{}, errors.New("in-place orientation can not swap width and height")
+	}
+	dst, srcDims, err := pix.ValidateProcessArgs(dst, pix.Dims{Shape: f.shape}, src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	outDims, err := pix.OutputDims(f, srcDims, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	r := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	if roi != nil {
+		r = *roi
+	}
+	if f.o.Swapped() {
+		if int64(len(dst)) < outDims.Size() {
+			return pix.Dims{}, errors.New("destination buffer not large enough to store output")
+		}
+		return outDims, f.swapBands(dst, outDims.Stride, src, srcDims, r)
+	}
+	dstOff, dstBitOff := 0, 0
+	if inPlace {
+		outDims.Stride = srcDims.Stride
+		dstOff, dstBitOff = r.Min.Y*srcDims.Stride, r.Min.X*srcDims.Shape.BitsPerPixel()
+	} else if int64(len(dst)) < outDims.Size() {
+		return pix.Dims{}, errors.New("destination buffer not large enough to store output")
+	}
+	return outDims, f.mirrorRowPairs(dst[dstOff:], outDims.Stride, dstBitOff, src, srcDims, r)
+}
+
+// ProcessRows implements [pix.RowProcessor]. For orientations that swap width and height the output rows
+// are source columns, so the column span of every source row within the ROI is read.
+func (f *Orient) ProcessRows(dst []byte, stride int, src pix.Image, roi *image.Rectangle, y0, y1 int) error {
+	srcDims := src.Dims()
+	outDims, err := pix.OutputDims(f, srcDims, roi)
+	if err != nil {
+		return err
+	} else if y0 < 0 || y1 > outDims.Height || y0 >= y1 {
+		return errors.New("invalid row range")
+	} else if stride < outDims.SizeRow() || len(dst) < (y1-y0-1)*stride+outDims.SizeRow() {
+		return errors.New("destination buffer not large enough to store output")
+	}
+	r := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	if roi != nil {
+		r = *roi
+	}
+	if f.o.Swapped() {
+		return f.swapColumns(dst, stride, src, srcDims, r, y0, y1)
+	}
+	bits := srcDims.Shape.BitsPerPixel()
+	mx, my := f.o.mirrors()
+	rowBuf := make([]byte, srcDims.SizeRow())
+	for y := y0; y < y1; y++ {
+		sy := y
+		if my {
+			sy = r.Dy() - 1 - y
+		}
+		row, err := pix.ImageRow(rowBuf, src, r.Min.Y+sy)
+		if err != nil {
+			return err
+		}
+		orientRow(dst[(y-y0)*stride:], 0, row, r.Min.X, r.Dx(), bits, mx)
+	}
+	return nil
+}
+
+// ProcessTo implements [pix.StreamFilter]. Output is computed in bands of rows with [Orient.ProcessRows]
+// so memory use is bounded by the band size.
+func (f *Orient) ProcessTo(dst pix.ImageWriter, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	outDims, err := pix.OutputDims(f, src.Dims(), roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	dstDims, _, err := pix.ValidateWriterArgs(dst, outDims, src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	rowSize := outDims.SizeRow()
+	band := make([]byte, orientTile*rowSize)
+	for y0 := 0; y0 < outDims.Height; y0 += orientTile {
+		y1 := min(y0+orientTile, outDims.Height)
+		err = f.ProcessRows(band, rowSize, src, roi, y0, y1)
+		if err != nil {
+			return pix.Dims{}, err
+		}
+		for y := y0; y < y1; y++ {
+			_, err = dst.WriteAt(band[(y-y0)*rowSize:][:rowSize], int64(y)*int64(dstDims.Stride))
+			if err != nil {
+				return pix.Dims{}, err
+			}
+		}
+	}
+	outDims.Stride = dstDims.Stride
+	return outDims, nil
+}
+
+// mirrorRowPairs writes the output of orientations which preserve width and height. Output rows y and
+// height-1-y are computed together from source rows read before either is written so dst may be src's buffer.
+func (f *Orient) mirrorRowPairs(dst []byte, stride, dstBitOff int, src pix.Image, srcDims pix.Dims, r image.Rectangle) error {
+	bits := srcDims.Shape.BitsPerPixel()
+	w, h := r.Dx(), r.Dy()
+	mx, my := f.o.mirrors()
+	rowBufs := [2][]byte{make([]byte, srcDims.SizeRow()), make([]byte, srcDims.SizeRow())}
+	packed := [2][]byte{make([]byte, (w*bits+7)/8), make([]byte, (w*bits+7)/8)}
+	for y := 0; y < (h+1)/2; y++ {
+		ys := [2]int{y, h - 1 - y}
+		for i, sy := range ys {
+			row, err := pix.ImageRow(rowBufs[i], src, r.Min.Y+sy)
+			if err != nil {
+				return err
+			}
+			pix.CopyBits(packed[i], 0, row, r.Min.X*bits, w*bits)
+		}
+		for i, oy := range ys {
+			p := packed[i]
+			if my {
+				p = packed[1-i]
+			}
+			orientRow(dst[oy*stride:], dstBitOff, p, 0, w, bits, mx)
+		}
+	}
+	return nil
+}
+
+// orientRow copies width pixels of src starting at pixel x0 to dst starting at bit offset dstBitOff,
+// reversing their order if mirror is set.
+func orientRow(dst []byte, dstBitOff int, src []byte, x0, width, bits int, mirror bool) {
+	if !mirror {
+		pix.CopyBits(dst, dstBitOff, src, x0*bits, width*bits)
+		return
+	}
+	for x := 0; x < width; x++ {
+		copyPixel(dst, dstBitOff+(width-1-x)*bits, src, (x0+x)*bits, bits)
+	}
+}
+
+// copyPixel copies a pixel of the given bits between bit offsets.
+func copyPixel(dst []byte, dstBit int, src []byte, srcBit, bits int) {
+	if bits%8 == 0 {
+		// Byte loop is faster than copy for the few bytes of a pixel.
+		d, s := dst[dstBit/8:][:bits/8], src[srcBit/8:][:bits/8]
+		for i := range d {
+			d[i] = s[i]
+		}
+		return
+	}
+	pix.CopyBits(dst, dstBit, src, srcBit, bits)
+}
+
+// swapMap maps source pixels of a width x height ROI to output pixels for orientations swapping width and height.
+type swapMap struct {
+	width, height int
+	mx, my        bool
+}
+
+func (f *Orient) swapMap(width, height int) swapMap {
+	mx, my := f.o.mirrors()
+	return swapMap{width: width, height: height, mx: mx, my: my}
+}
+
+// target returns the output pixel of source pixel (sx,sy).
+func (m swapMap) target(sx, sy int) (ox, oy int) {
+	ox, oy = sy, sx
+	if m.mx {
+		ox = m.height - 1 - sy
+	}
+	if m.my {
+		oy = m.width - 1 - sx
+	}
+	return ox, oy
+}
+
+// swapBands writes the full output of an orientation swapping width and height to dst.
+// Source rows are read in bands of orientTile rows with a single ReadAt call per band.
+// The band is small enough to remain in cache while it is transposed column by column.
+func (f *Orient) swapBands(dst []byte, stride int, src pix.Image, srcDims pix.Dims, r image.Rectangle) error {
+	bits := srcDims.Shape.BitsPerPixel()
+	w, h := r.Dx(), r.Dy()
+	m := f.swapMap(w, h)
+	var buf []byte
+	if buffered, ok := src.(pix.ImageBuffered); ok {
+		buf = buffered.Buffer()
+	}
+	var band []byte
+	if buf == nil {
+		band = make([]byte, (orientTile-1)*srcDims.Stride+srcDims.SizeRow())
+	}
+	for sy0 := 0; sy0 < h; sy0 += orientTile {
+		n := min(orientTile, h-sy0)
+		off := int64(r.Min.Y+sy0) * int64(srcDims.Stride)
+		size := (n-1)*srcDims.Stride + srcDims.SizeRow()
+		var rows []byte
+		if buf != nil {
+			rows = buf[off : off+int64(size)]
+		} else {
+			rows = band[:size]
+			if nr, err := src.ReadAt(rows, off); nr != size {
+				if err == nil {
+					err = errors.New("short read")
+				}
+				return err
+			}
+		}
+		if bits%8 != 0 {
+			for sx := 0; sx < w; sx++ {
+				for k := 0; k < n; k++ {
+					ox, oy := m.target(sx, sy0+k)
+					pix.CopyBits(dst[oy*stride:], ox*bits, rows[k*srcDims.Stride:], (r.Min.X+sx)*bits, bits)
+				}
+			}
+			continue
+		}
+		// Output row of source column sx gets pixels of consecutive source rows at consecutive columns.
+		bpp := bits / 8
+		step := bpp
+		if m.mx {
+			step = -bpp
+		}
+		for sx := 0; sx < w; sx++ {
+			ox, oy := m.target(sx, sy0)
+			d := oy*stride + ox*bpp
+			s := (r.Min.X + sx) * bpp
+			for k := 0; k < n; k++ {
+				for i := range bpp {
+					dst[d+i] = rows[s+i]
+				}
+				d += step
+				s += srcDims.Stride
+			}
+		}
+	}
+	return nil
+}
+
+// swapColumns writes output rows y0 to y1 of an orientation swapping width and height.
+// Output rows are source columns so only the bytes of the column span are read from every source row.
+func (f *Orient) swapColumns(dst []byte, stride int, src pix.Image, srcDims pix.Dims, r image.Rectangle, y0, y1 int) error {
+	bits := srcDims.Shape.BitsPerPixel()
+	w, h := r.Dx(), r.Dy()
+	m := f.swapMap(w, h)
+	// Source columns of output rows y0 to y1.
+	cx0, cx1 := y0, y1
+	if m.my {
+		cx0, cx1 = w-y1, w-y0
+	}
+	bit0, bit1 := (r.Min.X+cx0)*bits, (r.Min.X+cx1)*bits
+	byte0 := bit0 / 8
+	span := make([]byte, (bit1+7)/8-byte0)
+	for sy := 0; sy < h; sy++ {
+		off := int64(r.Min.Y+sy)*int64(srcDims.Stride) + int64(byte0)
+		if n, err := src.ReadAt(span, off); n != len(span) {
+			if err == nil {
+				err = errors.New("short read")
+			}
+			return err
+		}
+		for sx := cx0; sx < cx1; sx++ {
+			ox, oy := m.target(sx, sy)
+			copyPixel(dst[(oy-y0)*stride:], ox*bits, span, (r.Min.X+sx)*bits-8*byte0, bits)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+var orientations = []Orientation{OrientNone, OrientRotate90, OrientRotate180, OrientRotate270, OrientFlipHorizontal, OrientFlipVertical, OrientTranspose, OrientTransverse}
+
+// pixelBits returns the bits of pixel (x,y) of buf.
+func pixelBits(buf []byte, stride, x, y, bits int) uint32 {
+	var p [4]byte
+	pix.CopyBits(p[:], 32-bits, buf[y*stride:], x*bits, bits)
+	return uint32(p[0])<<24 | uint32(p[1])<<16 | uint32(p[2])<<8 | uint32(p[3])
+}
+
+// orientRef returns the source pixel of output pixel (ox,oy) for a width x height source.
+func orientRef(o Orientation, ox, oy, width, height int) (sx, sy int) {
+	switch o {
+	case OrientRotate90:
+		return oy, height - 1 - ox
+	case OrientRotate180:
+		return width - 1 - ox, height - 1 - oy
+	case OrientRotate270:
+		return width - 1 - oy, ox
+	case OrientFlipHorizontal:
+		return width - 1 - ox, oy
+	case OrientFlipVertical:
+		return ox, height - 1 - oy
+	case OrientTranspose:
+		return oy, ox
+	case OrientTransverse:
+		return width - 1 - oy, height - 1 - ox
+	}
+	return ox, oy
+}
+
+func checkOrient(t *testing.T, o Orientation, got []byte, gotDims pix.Dims, src *testImage, r image.Rectangle) {
+	t.Helper()
+	bits := src.dims.Shape.BitsPerPixel()
+	w, h := r.Dx(), r.Dy()
+	if o.Swapped() {
+		w, h = h, w
+	}
+	if gotDims.Width != w || gotDims.Height != h {
+		t.Fatalf("shape %d %s: got %dx%d output, want %dx%d", src.dims.Shape, o, gotDims.Width, gotDims.Height, w, h)
+	}
+	for oy := 0; oy < h; oy++ {
+		for ox := 0; ox < w; ox++ {
+			sx, sy := orientRef(o, ox, oy, r.Dx(), r.Dy())
+			want := pixelBits(src.buf, src.dims.Stride, r.Min.X+sx, r.Min.Y+sy, bits)
+			if v := pixelBits(got, gotDims.Stride, ox, oy, bits); v != want {
+				t.Fatalf("shape %d %s: pixel (%d,%d) got %#x, want %#x", src.dims.Shape, o, ox, oy, v, want)
+			}
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	for _, shape := range allShapes {
+		// Larger than a tile to cross tile boundaries with a ROI not aligned to bytes.
+		img := newRandomImage(newRand(), 75, 70, shape)
+		for _, roi := range []*image.Rectangle{nil, {Min: image.Pt(3, 1), Max: image.Pt(74, 68)}} {
+			r := image.Rect(0, 0, 75, 70)
+			if roi != nil {
+				r = *roi
+			}
+			for _, o := range orientations {
+				f, err := NewOrient(shape, o)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, src := range []pix.Image{img, readerImage{img}} {
+					dst := make([]byte, img.dims.Size())
+					dims, err := f.Process(dst, src, roi)
+					if err != nil {
+						t.Fatal(err)
+					}
+					checkOrient(t, o, dst, dims, img, r)
+				}
+
+				lazy, err := pix.NewLazyImage(f, readerImage{img}, roi)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(io.NewSectionReader(lazy, 0, lazy.Dims().Size()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkOrient(t, o, got, lazy.Dims(), img, r)
+
+				d := lazy.Dims()
+				d.Stride += 2
+				buf := make(sliceWriterAt, d.Size())
+				w, err := pix.NewImageWriter(buf, d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dims, err := f.ProcessTo(w, readerImage{img}, roi)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkOrient(t, o, buf, dims, img, r)
+			}
+		}
+	}
+}
+
+func TestOrientInPlace(t *testing.T) {
+	for _, shape := range allShapes {
+		for _, o := range orientations {
+			f, err := NewOrient(shape, o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img := newRandomImage(newRand(), 21, 12, shape)
+			orig := &testImage{dims: img.dims, buf: bytes.Clone(img.buf)}
+			roi := image.Rect(3, 2, 18, 11)
+			_, err = f.Process(nil, img, &roi)
+			if o.Swapped() {
+				if err == nil {
+					t.Errorf("%s: expected error for in-place swap", o)
+				}
+				continue
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			bits := shape.BitsPerPixel()
+			for y := 0; y < 12; y++ {
+				for x := 0; x < 21; x++ {
+					sx, sy := x, y
+					if image.Pt(x, y).In(roi) {
+						sx, sy = orientRef(o, x-roi.Min.X, y-roi.Min.Y, roi.Dx(), roi.Dy())
+						sx, sy = sx+roi.Min.X, sy+roi.Min.Y
+					}
+					want := pixelBits(orig.buf, orig.dims.Stride, sx, sy, bits)
+					if got := pixelBits(img.buf, img.dims.Stride, x, y, bits); got != want {
+						t.Fatalf("shape %d %s: pixel (%d,%d) got %#x, want %#x", shape, o, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// countingImage counts ReadAt calls to a streamed image.
+type countingImage struct {
+	readerImage
+	reads int
+}
+
+func (c *countingImage) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.readerImage.ReadAt(p, off)
+}
+
+func TestOrientRotateReads(t *testing.T) {
+	img := newRandomImage(newRand(), 200, 150, pix.ShapeMonochrome)
+	f, err := NewOrient(pix.ShapeMonochrome, OrientRotate90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &countingImage{readerImage: readerImage{img}}
+	dst := make([]byte, img.dims.Size())
+	_, err = f.Process(dst, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (150 + orientTile - 1) / orientTile; src.reads != want {
+		t.Errorf("got %d ReadAt calls, want one per band of rows: %d", src.reads, want)
+	}
+}
+
+func TestOrientRotateComposition(t *testing.T) {
+	img := newRandomImage(newRand(), 13, 6, pix.ShapeGrayscale2bit)
+	rot, err := NewOrient(pix.ShapeGrayscale2bit, OrientRotate90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPipeline(rot, rot, rot, rot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]byte, img.dims.Size())
+	dims, err := p.Process(dst, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrient(t, OrientNone, dst, dims, img, image.Rect(0, 0, 13, 6))
+}
+
+func BenchmarkOrientRotate90(b *testing.B) {
+	img := newRandomImage(newRand(), 1920, 1080, pix.ShapeRGB565BE)
+	f, err := NewOrient(pix.ShapeRGB565BE, OrientRotate90)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := make([]byte, len(img.buf))
+	for _, src := range []pix.Image{img, readerImage{img}} {
+		b.Run("", func(b *testing.B) {
+			b.SetBytes(int64(len(img.buf)))
+			for i := 0; i < b.N; i++ {
+				_, err := f.Process(dst, src, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/soypat/pix"
+)
+
+// Pipeline chains filters so the output of each stage is the input of the next.
+// Pipeline implements [pix.Filter] so it may be used anywhere a single filter is expected.
+//
+// Intermediate results are stored in two buffers which are reused between stages
+// and between calls to Process, so a Pipeline must not be used by multiple goroutines concurrently.
+// Stages which change the width or height of their input must implement [pix.DimsFilter]
+// so intermediate buffers can be sized.
+type Pipeline struct {
+	// Fuse enables row-fused execution. Consecutive [PointFilter] stages are applied
+	// to one row at a time while it is still in cache and only the output of the
+	// last stage of each fused run is stored, see [FusePointFilters].
+	Fuse   bool
+	stages []pix.Filter
+	fused  []pix.Filter
+	// ping-pong intermediate buffers.
+	bufs [2][]byte
+}
+
+// NewPipeline creates a pipeline which applies stages in order.
+// It fails if the output shape of a stage does not match the input shape of the next stage.
+func NewPipeline(stages ...pix.Filter) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("empty pipeline")
+	}
+	for i := 1; i < len(stages); i++ {
+		out, _ := stages[i-1].ShapeIO()
+		_, in := stages[i].ShapeIO()
+		if out != in {
+			return nil, fmt.Errorf("stage %d output shape %d does not match stage %d input shape %d", i-1, out, i, in)
+		}
+	}
+	fused, err := fuseStages(stages)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{stages: stages, fused: fused}, nil
+}
+
+// fuseStages replaces runs of consecutive point filters with a single fused point filter.
+func fuseStages(stages []pix.Filter) ([]pix.Filter, error) {
+	var fused []pix.Filter
+	var run []*PointFilter
+	flush := func() error {
+		switch len(run) {
+		case 0:
+			return nil
+		case 1:
+			fused = append(fused, run[0])
+		default:
+			f, err := FusePointFilters(run...)
+			if err != nil {
+				return err
+			}
+			fused = append(fused, f)
+		}
+		run = run[:0]
+		return nil
+	}
+	for _, stage := range stages {
+		if pf, ok := stage.(*PointFilter); ok && pf.Fn != nil {
+			run = append(run, pf)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		fused = append(fused, stage)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return fused, nil
+}
+
+// active returns the stages to run depending on whether fusion is enabled.
+func (p *Pipeline) active() []pix.Filter {
+	if p.Fuse {
+		return p.fused
+	}
+	return p.stages
+}
+
+// Stages returns the filters of the pipeline in order of application.
+func (p *Pipeline) Stages() []pix.Filter {
+	return p.stages
+}
+
+// OutputDims implements [pix.DimsFilter] by chaining the output dimensions of all stages.
+func (p *Pipeline) OutputDims(src pix.Dims, roi *image.Rectangle) (pix.Dims, error) {
+	for i, stage := range p.stages {
+		d, err := pix.OutputDims(stage, src, roi)
+		if err != nil {
+			return pix.Dims{}, fmt.Errorf("stage %d: %w", i, err)
+		}
+		src, roi = d, nil
+	}
+	return src, nil
+}
+
+// ShapeIO implements [pix.Filter].
+func (p *Pipeline) ShapeIO() (output, input pix.Shape) {
+	output, _ = p.stages[len(p.stages)-1].ShapeIO()
+	_, input = p.stages[0].ShapeIO()
+	return output, input
+}
+
+// Controls implements [pix.Filter]. Returns the controls of all stages in order.
+func (p *Pipeline) Controls() []pix.Control {
+	var ctrls []pix.Control
+	for _, stage := range p.stages {
+		ctrls = append(ctrls, stage.Controls()...)
+	}
+	return ctrls
+}
+
+// Process implements [pix.Filter]. The ROI is passed to the first stage only,
+// following stages process the complete output of the previous stage.
+func (p *Pipeline) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	return p.ProcessContext(context.Background(), dst, src, roi, nil)
+}
+
+// ProcessContext implements [pix.ContextFilter]. ctx and progress are forwarded to every stage
+// via [pix.ProcessContext]. Progress is reported as the output rows done over the output rows of all stages,
+// which differ between stages that resize their input.
+func (p *Pipeline) ProcessContext(ctx context.Context, dst []byte, src pix.Image, roi *image.Rectangle, progress pix.ProgressFunc) (pix.Dims, error) {
+	stages := p.active()
+	if len(stages) == 1 {
+		return pix.ProcessContext(ctx, stages[0], dst, src, roi, progress)
+	}
+	if dst == nil {
+		return p.processInPlace(ctx, stages, src, roi, progress)
+	}
+	sp, err := stageProgress(progress, stages, src.Dims(), roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	prev, err := p.processIntermediate(ctx, stages, src, roi, sp)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	last := len(stages) - 1
+	return pix.ProcessContext(ctx, stages[last], dst, prev, nil, sp(last))
+}
+
+// ProcessTo implements [pix.StreamFilter]. The last stage streams its output to dst.
+func (p *Pipeline) ProcessTo(dst pix.ImageWriter, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	stages := p.active()
+	last := stages[len(stages)-1]
+	if len(stages) == 1 {
+		return pix.ProcessTo(dst, last, src, roi)
+	}
+	sp, _ := stageProgress(nil, stages, src.Dims(), roi)
+	prev, err := p.processIntermediate(context.Background(), stages, src, roi, sp)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	return pix.ProcessTo(dst, last, prev, nil)
+}
+
+// stageProgress returns a function which maps the progress of stage i to the progress of the whole pipeline.
+// The output rows of each stage are computed with [pix.OutputDims] so rows done are accumulated
+// correctly when stages change the height of the image.
+func stageProgress(progress pix.ProgressFunc, stages []pix.Filter, src pix.Dims, roi *image.Rectangle) (func(i int) pix.ProgressFunc, error) {
+	if progress == nil {
+		return func(int) pix.ProgressFunc { return nil }, nil
+	}
+	// offsets[i] is the number of rows output by the stages before stage i.
+	offsets := make([]int, len(stages)+1)
+	for i, stage := range stages {
+		d, err := pix.OutputDims(stage, src, roi)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		offsets[i+1] = offsets[i] + d.Height
+		src, roi = d, nil
+	}
+	total := offsets[len(stages)]
+	return func(i int) pix.ProgressFunc {
+		rows := offsets[i+1] - offsets[i]
+		return func(rowsDone, rowsTotal int) {
+			if rowsTotal != rows && rowsTotal > 0 {
+				rowsDone = rowsDone * rows / rowsTotal
+			}
+			progress(offsets[i]+rowsDone, total)
+		}
+	}, nil
+}
+
+// processIntermediate processes all stages but the last and returns the result of the second to last stage.
+// progress returns the progress function of each stage, see [stageProgress].
+func (p *Pipeline) processIntermediate(ctx context.Context, stages []pix.Filter, src pix.Image, roi *image.Rectangle, progress func(i int) pix.ProgressFunc) (pix.Image, error) {
+	prev := src
+	for i, stage := range stages[:len(stages)-1] {
+		stageRoi := roi
+		if i > 0 {
+			stageRoi = nil
+		}
+		d, err := pix.OutputDims(stage, prev.Dims(), stageRoi)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		buf := p.buffer(i%2, int(d.Size()))
+		outDims, err := pix.ProcessContext(ctx, stage, buf, prev, stageRoi, progress(i))
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		prev, err = pix.NewMemImage(buf, outDims)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d output: %w", i, err)
+		}
+	}
+	return prev, nil
+}
+
+// processInPlace processes all stages into intermediate buffers and
+// then copies the result into src's buffer at the ROI location.
+func (p *Pipeline) processInPlace(ctx context.Context, stages []pix.Filter, src pix.Image, roi *image.Rectangle, progress pix.ProgressFunc) (pix.Dims, error) {
+	out, _ := p.ShapeIO()
+	dst, srcDims, err := pix.ValidateProcessArgs(nil, pix.Dims{Shape: out}, src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	sp, err := stageProgress(progress, stages, src.Dims(), roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	prev, err := p.processIntermediate(ctx, stages, src, roi, sp)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	last := stages[len(stages)-1]
+	d, err := pix.OutputDims(last, prev.Dims(), nil)
+	if err != nil {
+		return pix.Dims{}, fmt.Errorf("stage %d: %w", len(stages)-1, err)
+	}
+	tmp := p.buffer((len(stages)-1)%2, int(d.Size()))
+	outDims, err := pix.ProcessContext(ctx, last, tmp, prev, nil, sp(len(stages)-1))
+	if err != nil {
+		return pix.Dims{}, fmt.Errorf("stage %d: %w", len(stages)-1, err)
+	}
+	r := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	if roi != nil {
+		r = *roi
+	}
+	if outDims.Width != r.Dx() || outDims.Height != r.Dy() || outDims.Shape != out {
+		return pix.Dims{}, errors.New("pipeline output does not fit in-place")
+	}
+	bits := out.BitsPerPixel()
+	for y := 0; y < outDims.Height; y++ {
+		pix.CopyBits(dst[(r.Min.Y+y)*srcDims.Stride:], r.Min.X*bits, tmp[y*outDims.Stride:], 0, outDims.Width*bits)
+	}
+	outDims.Stride = srcDims.Stride
+	return outDims, nil
+}
+
+// buffer returns intermediate buffer i with at least size bytes.
+func (p *Pipeline) buffer(i, size int) []byte {
+	if cap(p.bufs[i]) < size {
+		p.bufs[i] = make([]byte, size)
+	}
+	return p.bufs[i][:size]
+}
@@ -0,0 +1,205 @@
+package filters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+func newTestPipeline(t testing.TB) (*Pipeline, []pix.Filter) {
+	convert, err := NewConvert(pix.ShapeRGB565BE, pix.ShapeRGB888)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := []pix.Filter{NewGrayscalePerPixel(GrayscaleAverage), NewInvertedPerPixel(), convert}
+	p, err := NewPipeline(stages...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, stages
+}
+
+// processChained applies stages manually allocating intermediate buffers.
+func processChained(t testing.TB, stages []pix.Filter, src pix.Image, roi *image.Rectangle) []byte {
+	var prev = src
+	var buf []byte
+	for i, stage := range stages {
+		buf = make([]byte, 4*src.Dims().NumPixels())
+		r := roi
+		if i > 0 {
+			r = nil
+		}
+		dims, err := stage.Process(buf, prev, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev = &testImage{dims: dims, buf: buf}
+	}
+	d := prev.Dims()
+	return buf[:d.Size()]
+}
+
+func TestPipeline(t *testing.T) {
+	p, stages := newTestPipeline(t)
+	out, in := p.ShapeIO()
+	if out != pix.ShapeRGB565BE || in != pix.ShapeRGB888 {
+		t.Errorf("bad pipeline shapes %d->%d", in, out)
+	}
+	if len(p.Controls()) != 1 {
+		t.Errorf("expected grayscale control in pipeline controls, got %d controls", len(p.Controls()))
+	}
+	src := newRandomImage(newRand(), 17, 11, pix.ShapeRGB888)
+	for _, roi := range []*image.Rectangle{nil, {Min: image.Pt(2, 3), Max: image.Pt(15, 10)}} {
+		want := processChained(t, stages, src, roi)
+		got := make([]byte, len(want))
+		for i := 0; i < 2; i++ { // Second pass reuses intermediate buffers.
+			dims, err := p.Process(got, readerImage{src}, roi)
+			if err != nil {
+				t.Fatal(err)
+			} else if dims.Shape != pix.ShapeRGB565BE {
+				t.Fatalf("bad output shape %d", dims.Shape)
+			} else if !bytes.Equal(got, want) {
+				t.Fatalf("roi=%v: pipeline output does not match chained filters", roi)
+			}
+		}
+	}
+}
+
+func TestPipelineInPlace(t *testing.T) {
+	p, err := NewPipeline(NewGrayscalePerPixel(GrayscaleLuminance), NewInvertedPerPixel())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newRandomImage(newRand(), 12, 9, pix.ShapeRGB888)
+	roi := image.Rect(1, 2, 9, 8)
+	want := processChained(t, p.Stages(), src, &roi)
+	_, err = p.Process(nil, src, &roi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < roi.Dy(); y++ {
+		got := src.buf[(y+roi.Min.Y)*src.dims.Stride+3*roi.Min.X:][:3*roi.Dx()]
+		if !bytes.Equal(got, want[y*3*roi.Dx():][:3*roi.Dx()]) {
+			t.Fatalf("row %d mismatch", y)
+		}
+	}
+}
+
+func TestPipelineShapeMismatch(t *testing.T) {
+	convert, _ := NewConvert(pix.ShapeMonochrome, pix.ShapeRGB888)
+	_, err := NewPipeline(convert, NewInvertedPerPixel())
+	if err == nil {
+		t.Error("expected shape mismatch error")
+	}
+}
+
+func TestPipelineFused(t *testing.T) {
+	p, _ := newTestPipeline(t)
+	if len(p.fused) != 1 {
+		t.Fatalf("expected all point filter stages fused into one, got %d stages", len(p.fused))
+	}
+	src := newRandomImage(newRand(), 23, 7, pix.ShapeRGB888)
+	for _, roi := range []*image.Rectangle{nil, {Min: image.Pt(5, 1), Max: image.Pt(20, 6)}} {
+		p.Fuse = false
+		want := make([]byte, 2*23*7)
+		_, err := p.Process(want, src, roi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Fuse = true
+		got := make([]byte, len(want))
+		_, err = p.Process(got, readerImage{src}, roi)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("roi=%v: fused output does not match unfused output", roi)
+		}
+	}
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	const width, height = 3000, 2000
+	src := newRandomImage(newRand(), width, height, pix.ShapeRGB888)
+	dst := make([]byte, 2*width*height)
+	for _, fuse := range []bool{false, true} {
+		name := "unfused"
+		if fuse {
+			name = "fused"
+		}
+		b.Run(name, func(b *testing.B) {
+			p, _ := newTestPipeline(b)
+			p.Fuse = fuse
+			b.SetBytes(3 * width * height)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := p.Process(dst, src, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineProcessContext(t *testing.T) {
+	p, _ := newTestPipeline(t)
+	src := newRandomImage(newRand(), 16, 10, pix.ShapeRGB888)
+	dst := make([]byte, 2*16*10)
+	var last, calls int
+	_, err := p.ProcessContext(context.Background(), dst, src, nil, func(done, total int) {
+		if done <= last || total != 3*10 {
+			t.Fatalf("bad progress %d/%d after %d", done, total, last)
+		}
+		last = done
+		calls++
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if last != 3*10 || calls != 3*10 {
+		t.Errorf("expected progress to finish at 30 rows in 30 calls, got %d rows in %d calls", last, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = p.ProcessContext(ctx, dst, src, nil, func(done, total int) {
+		if done == 12 {
+			cancel()
+		} else if done > 13 {
+			t.Fatalf("processing continued after cancellation: %d/%d", done, total)
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled error, got %v", err)
+	}
+}
+
+func TestPipelineProgressResize(t *testing.T) {
+	rz, err := NewResize(pix.ShapeRGB888, 8, 30, ResizeNearest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPipeline(NewInvertedPerPixel(), rz, NewInvertedPerPixel())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newRandomImage(newRand(), 16, 10, pix.ShapeRGB888)
+	dst := make([]byte, 3*8*30)
+	// Progress covers 10 rows of the first stage and 30 rows of each of the following stages.
+	const total = 10 + 30 + 30
+	var last int
+	_, err = p.ProcessContext(context.Background(), dst, src, nil, func(done, gotTotal int) {
+		if done <= last || done > total || gotTotal != total {
+			t.Fatalf("bad progress %d/%d after %d", done, gotTotal, last)
+		}
+		last = done
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if last != total {
+		t.Errorf("progress finished at %d rows, want %d", last, total)
+	}
+}
@@ -1,8 +1,11 @@
 package filters
 
 import (
+	"context"
 	"errors"
 	"image"
+	"sync"
+	"sync/atomic"
 
 	"github.com/soypat/pix"
 )
@@ -12,6 +15,9 @@ var errShapeMismatch = errors.New("pixel shape mismatch")
 // PointFunc processes a contiguous row of pixels.
 // dst and src contain rowWidth pixels worth of bytes.
 // The function should iterate through pixels: for i := 0; i < len(src); i += bytesPerPixel { ... }
+//
+// Rows of sub-byte shapes always start on a byte boundary and may contain padding pixels
+// in their last byte which are safe to process.
 type PointFunc func(dst, src []byte)
 
 // PointFilter applies a per-pixel transformation using a callback function.
@@ -22,6 +28,10 @@ type PointFilter struct {
 	Out   pix.Shape
 	Fn    PointFunc
 	Ctrls []pix.Control // User-defined controls for this filter.
+	// Workers is the number of goroutines that process bands of rows concurrently.
+	// Output is identical to serial processing. Values below 2 process all rows on the calling goroutine.
+	// Fn must be safe for concurrent use when Workers is greater than 1.
+	Workers int
 }
 
 // ShapeIO implements [Filter].
@@ -39,84 +49,402 @@ func (f *PointFilter) Process(dst []byte, src pix.Image, roi *image.Rectangle) (
 	if f.Fn == nil {
 		return pix.Dims{}, errNilPixelFunc
 	}
+	return f.job(src, roi).process(dst)
+}
 
-	outShape, inShape := f.ShapeIO()
-	srcDims := src.Dims()
-	if srcDims.Shape != inShape {
-		return pix.Dims{}, errShapeMismatch
+// ProcessContext implements [pix.ContextFilter]. ctx is checked before processing each row.
+func (f *PointFilter) ProcessContext(ctx context.Context, dst []byte, src pix.Image, roi *image.Rectangle, progress pix.ProgressFunc) (pix.Dims, error) {
+	if f.Fn == nil {
+		return pix.Dims{}, errNilPixelFunc
 	}
+	job := f.job(src, roi)
+	job.ctx, job.progress = ctx, progress
+	return job.process(dst)
+}
 
-	inBytesPerPixel := (inShape.BitsPerPixel() + 7) / 8
-	outBytesPerPixel := (outShape.BitsPerPixel() + 7) / 8
+// ProcessTo implements [pix.StreamFilter]. Memory usage is bounded to a few rows.
+func (f *PointFilter) ProcessTo(dst pix.ImageWriter, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	if f.Fn == nil {
+		return pix.Dims{}, errNilPixelFunc
+	}
+	return f.job(src, roi).processTo(dst)
+}
 
-	// Calculate output dimensions based on ROI or full image.
-	var outWidth, outHeight int
-	if roi != nil {
-		outWidth, outHeight = roi.Dx(), roi.Dy()
-	} else {
-		outWidth, outHeight = srcDims.Width, srcDims.Height
+// ProcessRows implements [pix.RowProcessor] so the filter can back a [pix.LazyImage].
+func (f *PointFilter) ProcessRows(dst []byte, stride int, src pix.Image, roi *image.Rectangle, y0, y1 int) error {
+	if f.Fn == nil {
+		return errNilPixelFunc
+	}
+	return f.job(src, roi).processRows(dst, stride, y0, y1)
+}
+
+func (f *PointFilter) job(src pix.Image, roi *image.Rectangle) *rowJob {
+	fn := f.Fn
+	return &rowJob{
+		src:     src,
+		roi:     roi,
+		out:     f.Out,
+		in:      f.In,
+		fn:      func(dst, src []byte, _ int) { fn(dst, src) },
+		workers: f.Workers,
 	}
-	outStride := outWidth * outBytesPerPixel
+}
 
+// rowJob is the row loop shared by row based filters. It validates arguments and
+// calls fn for every row of the processed region in order from top to bottom.
+type rowJob struct {
+	src     pix.Image
+	roi     *image.Rectangle
+	out, in pix.Shape
+	// begin, if not nil, is called with the output dimensions before the first row is processed.
+	begin func(pix.Dims)
+	fn    ScanFunc
+	// workers is the number of concurrent row bands. Row order is only guaranteed for workers<2.
+	workers int
+	// ctx, if not nil, is checked before processing each row.
+	ctx context.Context
+	// progress, if not nil, is called after processing each row.
+	progress pix.ProgressFunc
+	// yOff is added to the row index passed to callbacks when processing a band of the output.
+	yOff int
+	// wfn, if not nil, replaces fn and is passed a window of source rows around each row.
+	wfn    NeighborhoodFunc
+	radius int
+	border BorderMode
+	fill   []byte // Pixel for BorderConstant in the input shape.
+}
+
+// outDims returns the output dimensions with a packed stride.
+func (job *rowJob) outDims() (pix.Dims, error) {
+	srcDims := job.src.Dims()
+	if srcDims.Shape != job.in {
+		return pix.Dims{}, errShapeMismatch
+	}
+	// Calculate output dimensions based on ROI or full image.
 	dstDims := pix.Dims{
-		Width:  outWidth,
-		Height: outHeight,
-		Stride: outStride,
-		Shape:  outShape,
+		Width:  srcDims.Width,
+		Height: srcDims.Height,
+		Shape:  job.out,
+	}
+	if job.roi != nil {
+		dstDims.Width, dstDims.Height = job.roi.Dx(), job.roi.Dy()
+	}
+	dstDims.Stride = dstDims.SizeRow()
+	return dstDims, nil
+}
+
+// region returns the source region to process.
+func (job *rowJob) region(srcDims pix.Dims) image.Rectangle {
+	if job.roi != nil {
+		return *job.roi
 	}
+	return image.Rect(0, 0, srcDims.Width, srcDims.Height)
+}
 
-	dst, _, err := pix.ValidateProcessArgs(dst, dstDims, src, roi)
+// process writes output to dst or in-place if dst is nil.
+func (job *rowJob) process(dst []byte) (pix.Dims, error) {
+	dstDims, err := job.outDims()
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	inPlace := dst == nil
+	dst, srcDims, err := pix.ValidateProcessArgs(dst, dstDims, job.src, job.roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	r := job.region(srcDims)
+	outBits := job.out.BitsPerPixel()
+	outRowBytes := dstDims.SizeRow()
+	dstOff, dstBitOff := 0, 0
+	merge := false
+	if inPlace {
+		// In-place output shares the source's memory layout and is written at the ROI location.
+		dstDims.Stride = srcDims.Stride
+		dstOff = r.Min.Y * srcDims.Stride
+		dstBitOff = r.Min.X * outBits
+		if job.wfn != nil {
+			// Bands would read apron rows already overwritten by the band above.
+			job.workers = 1
+		}
+		if dstBitOff%8 != 0 || (dstDims.Width*outBits)%8 != 0 {
+			// Row does not start or end on a byte boundary, merge bits to preserve pixels outside ROI.
+			merge = true
+		}
+	}
+	outStride := dstDims.Stride
+	err = job.rows(srcDims, dstDims, func() rowSink {
+		var mergeBuf []byte
+		if merge {
+			mergeBuf = make([]byte, outRowBytes)
+		}
+		return func(y int, srcRow []byte, win *Window) error {
+			dstRowStart := dstOff + y*outStride
+			if mergeBuf != nil {
+				job.apply(mergeBuf, srcRow, win, y)
+				pix.CopyBits(dst[dstRowStart:], dstBitOff, mergeBuf, 0, dstDims.Width*outBits)
+			} else {
+				dstRowStart += dstBitOff / 8
+				job.apply(dst[dstRowStart:dstRowStart+outRowBytes], srcRow, win, y)
+			}
+			return nil
+		}
+	})
 	if err != nil {
 		return pix.Dims{}, err
 	}
+	return dstDims, nil
+}
 
-	// Determine source region to process.
-	startX, startY := 0, 0
-	endX, endY := srcDims.Width, srcDims.Height
-	if roi != nil {
-		startX, startY = roi.Min.X, roi.Min.Y
-		endX, endY = roi.Max.X, roi.Max.Y
+// processRows writes output rows [y0,y1) to dst separated by stride bytes.
+func (job *rowJob) processRows(dst []byte, stride int, y0, y1 int) error {
+	dstDims, err := job.outDims()
+	if err != nil {
+		return err
+	}
+	_, srcDims, err := pix.ValidateProcessArgs(dst, pix.Dims{Shape: job.out}, job.src, job.roi)
+	if err != nil {
+		return err
+	}
+	outRowBytes := dstDims.SizeRow()
+	if y0 < 0 || y1 > dstDims.Height || y0 >= y1 {
+		return errors.New("rows out of bounds")
+	} else if stride < outRowBytes {
+		return errors.New("stride smaller than output row size")
+	} else if len(dst) < (y1-y0-1)*stride+outRowBytes {
+		return errors.New("destination buffer not large enough to store rows")
 	}
+	r := job.region(srcDims)
+	sub := image.Rect(r.Min.X, r.Min.Y+y0, r.Max.X, r.Min.Y+y1)
+	job.roi = &sub
+	job.yOff = y0
+	dstDims.Height = y1 - y0
+	dstDims.Stride = stride
+	return job.rows(srcDims, dstDims, func() rowSink {
+		return func(y int, srcRow []byte, win *Window) error {
+			job.apply(dst[y*stride:y*stride+outRowBytes], srcRow, win, y)
+			return nil
+		}
+	})
+}
+
+// processTo writes output row by row to dst.
+func (job *rowJob) processTo(dst pix.ImageWriter) (pix.Dims, error) {
+	outDims, err := job.outDims()
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	dstDims, srcDims, err := pix.ValidateWriterArgs(dst, outDims, job.src, job.roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	err = job.rows(srcDims, dstDims, func() rowSink {
+		rowBuf := make([]byte, dstDims.SizeRow())
+		return func(y int, srcRow []byte, win *Window) error {
+			job.apply(rowBuf, srcRow, win, y)
+			_, err := dst.WriteAt(rowBuf, int64(y)*int64(dstDims.Stride))
+			return err
+		}
+	})
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	return dstDims, nil
+}
+
+// rowSink receives source rows of the processed region aligned to start on a byte boundary,
+// or the window around the row for neighborhood jobs. y is relative to the region.
+type rowSink func(y int, srcRow []byte, win *Window) error
+
+// apply computes output row y into dst.
+func (job *rowJob) apply(dst, srcRow []byte, win *Window, y int) {
+	y += job.yOff
+	if win != nil {
+		win.Y = y
+		job.wfn(dst, win)
+		return
+	}
+	job.fn(dst, srcRow, y)
+}
+
+// rows calls the begin callback and then yields each source row of the processed region.
+// Rows are split in bands processed concurrently if job.workers>1, each band
+// yielding to its own sink created by newSink so sinks may own scratch buffers.
+func (job *rowJob) rows(srcDims, dstDims pix.Dims, newSink func() rowSink) error {
+	r := job.region(srcDims)
+	if job.begin != nil {
+		job.begin(dstDims)
+	}
+	var (
+		mu       sync.Mutex
+		done     int
+		firstErr error
+		failed   atomic.Bool // Signals bands to stop on error.
+	)
+	// wrap checks for cancellation and reports progress around sink.
+	wrap := func(sink rowSink) rowSink {
+		if job.ctx == nil && job.progress == nil && job.workers < 2 {
+			return sink
+		}
+		return func(y int, srcRow []byte, win *Window) error {
+			if failed.Load() {
+				return errBandStopped
+			} else if job.ctx != nil {
+				if err := job.ctx.Err(); err != nil {
+					return err
+				}
+			}
+			if err := sink(y, srcRow, win); err != nil {
+				return err
+			}
+			if job.progress != nil {
+				mu.Lock()
+				done++
+				job.progress(done, r.Dy())
+				mu.Unlock()
+			}
+			return nil
+		}
+	}
+	nbands := max(1, min(job.workers, r.Dy()))
+	if nbands == 1 {
+		return job.band(srcDims, r, wrap(newSink()))
+	}
+	bandHeight := (r.Dy() + nbands - 1) / nbands
+	var wg sync.WaitGroup
+	for y0 := r.Min.Y; y0 < r.Max.Y; y0 += bandHeight {
+		band := image.Rect(r.Min.X, y0, r.Max.X, min(y0+bandHeight, r.Max.Y))
+		offset := y0 - r.Min.Y
+		sink := wrap(newSink())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := job.band(srcDims, band, func(y int, srcRow []byte, win *Window) error {
+				return sink(y+offset, srcRow, win)
+			})
+			if err != nil && err != errBandStopped {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					failed.Store(true)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// band yields the source rows of region r in order. y is relative to r.
+func (job *rowJob) band(srcDims pix.Dims, r image.Rectangle, yield rowSink) error {
+	if job.wfn != nil {
+		return job.windowBand(srcDims, r, yield)
+	}
+	inBits := job.in.BitsPerPixel()
 
 	// Try to get direct buffer access for better performance.
 	var srcBuf []byte
-	if buffered, ok := src.(pix.ImageBuffered); ok {
+	if buffered, ok := job.src.(pix.ImageBuffered); ok {
 		srcBuf = buffered.Buffer()
 	}
 
 	// Process row by row.
 	srcRowBytes := srcDims.SizeRow()
-	rowBuf := make([]byte, srcRowBytes) // Fallback buffer for ReadAt.
+	var rowBuf []byte // Fallback buffer for ReadAt.
+	if srcBuf == nil {
+		rowBuf = make([]byte, srcRowBytes)
+	}
+	srcBitStart := r.Min.X * inBits
+	roiRowBytes := (r.Dx()*inBits + 7) / 8
+	var alignBuf []byte
+	if srcBitStart%8 != 0 {
+		// Sub-byte ROI not aligned to a byte boundary, shift pixels to start of buffer.
+		alignBuf = make([]byte, roiRowBytes)
+	}
 
-	for y := startY; y < endY; y++ {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
 		// Get source row data.
 		var srcRow []byte
 		srcRowStart := y * srcDims.Stride
 		if srcBuf != nil {
 			srcRow = srcBuf[srcRowStart : srcRowStart+srcRowBytes]
 		} else {
-			_, err := src.ReadAt(rowBuf, int64(srcRowStart))
+			_, err := job.src.ReadAt(rowBuf, int64(srcRowStart))
 			if err != nil {
-				return pix.Dims{}, err
+				return err
 			}
 			srcRow = rowBuf
 		}
-
-		// Calculate row slice bounds.
-		dstY := y - startY
-		dstRowStart := dstY * outStride
-		srcStart := startX * inBytesPerPixel
-		srcEnd := endX * inBytesPerPixel
-
+		if alignBuf != nil {
+			pix.CopyBits(alignBuf, 0, srcRow, srcBitStart, r.Dx()*inBits)
+			srcRow = alignBuf
+		} else {
+			srcRow = srcRow[srcBitStart/8 : srcBitStart/8+roiRowBytes]
+		}
 		// Process entire row at once.
-		f.Fn(dst[dstRowStart:dstRowStart+outStride], srcRow[srcStart:srcEnd])
+		if err := yield(y-r.Min.Y, srcRow, nil); err != nil {
+			return err
+		}
 	}
-
-	return dstDims, nil
+	return nil
 }
 
-var errNilPixelFunc = errorString("nil PixelFunc")
+var (
+	errNilPixelFunc = errorString("nil PixelFunc")
+	errBandStopped  = errorString("band stopped due to error in another band")
+)
 
 type errorString string
 
 func (e errorString) Error() string { return string(e) }
+
+// FusePointFilters returns a single [PointFilter] equivalent to applying filters in order.
+// All filters are applied to a row while it is still in cache using one small scratch row
+// per intermediate stage instead of a full intermediate image. Controls of the fused
+// filter are the controls of all filters in order and Workers is the largest Workers of filters.
+func FusePointFilters(filters ...*PointFilter) (*PointFilter, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("no filters to fuse")
+	}
+	for i := 1; i < len(filters); i++ {
+		if filters[i-1].Out != filters[i].In {
+			return nil, errShapeMismatch
+		}
+	}
+	var ctrls []pix.Control
+	workers := 0
+	for _, f := range filters {
+		ctrls = append(ctrls, f.Ctrls...)
+		workers = max(workers, f.Workers)
+	}
+	first, last := filters[0], filters[len(filters)-1]
+	inBits, outBits := first.In.BitsPerPixel(), last.Out.BitsPerPixel()
+	// Scratch rows are pooled so the fused function may be called concurrently.
+	var pool sync.Pool
+	return &PointFilter{
+		In:  first.In,
+		Out: last.Out,
+		Fn: func(dst, src []byte) {
+			width := min(len(src)*8/inBits, len(dst)*8/outBits)
+			scratch, _ := pool.Get().(*[][]byte)
+			if scratch == nil {
+				scratch = new([][]byte)
+				*scratch = make([][]byte, len(filters)-1)
+			}
+			prev := src
+			for i, f := range filters[:len(filters)-1] {
+				size := (width*f.Out.BitsPerPixel() + 7) / 8
+				if cap((*scratch)[i]) < size {
+					(*scratch)[i] = make([]byte, size)
+				}
+				row := (*scratch)[i][:size]
+				f.Fn(row, prev)
+				prev = row
+			}
+			last.Fn(dst, prev)
+			pool.Put(scratch)
+		},
+		Ctrls:   ctrls,
+		Workers: workers,
+	}, nil
+}
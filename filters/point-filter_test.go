@@ -0,0 +1,263 @@
+package filters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+func TestPointFilterInPlaceSubImage(t *testing.T) {
+	const width, height = 10, 8
+	parent := newRandomImage(newRand(), width, height, pix.ShapeRGB888)
+	original := bytes.Clone(parent.buf)
+	rect := image.Rect(2, 3, 7, 6)
+	sub, err := pix.SubImage(parent, rect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dims, err := NewInvertedPerPixel().Process(nil, sub, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if dims.Stride != parent.dims.Stride {
+		t.Errorf("in-place stride got %d, want source stride %d", dims.Stride, parent.dims.Stride)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			off := y*parent.dims.Stride + 3*x
+			for c := 0; c < 3; c++ {
+				want := original[off+c]
+				if image.Pt(x, y).In(rect) {
+					want = 255 - want
+				}
+				if got := parent.buf[off+c]; got != want {
+					t.Fatalf("pixel (%d,%d) channel %d: got %d, want %d", x, y, c, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPointFilterInPlaceROI(t *testing.T) {
+	const width, height = 21, 6
+	rect := image.Rect(3, 1, 14, 5)
+	for _, shape := range allShapes {
+		img := newRandomImage(newRand(), width, height, shape)
+		original := &testImage{dims: img.dims, buf: bytes.Clone(img.buf)}
+		// Inverting all bits modifies every pixel regardless of shape.
+		filter := &PointFilter{In: shape, Out: shape, Fn: func(dst, src []byte) {
+			for i := range src {
+				dst[i] = ^src[i]
+			}
+		}}
+		dims, err := filter.Process(nil, img, &rect)
+		if err != nil {
+			t.Fatal(err)
+		} else if dims.Width != rect.Dx() || dims.Height != rect.Dy() || dims.Stride != img.dims.Stride {
+			t.Fatalf("shape %d: bad in-place dims %+v", shape, dims)
+		}
+		codec, _ := shape.Codec()
+		for y := 0; y < height; y++ {
+			row := img.buf[y*img.dims.Stride:]
+			origRow := original.buf[y*img.dims.Stride:]
+			for x := 0; x < width; x++ {
+				want := codec.Decode(origRow, x)
+				if image.Pt(x, y).In(rect) {
+					// Invert raw pixel bits in a scratch row to obtain expected value.
+					scratch := make([]byte, 4)
+					pix.CopyBits(scratch, 0, origRow, x*shape.BitsPerPixel(), shape.BitsPerPixel())
+					for i := range scratch {
+						scratch[i] = ^scratch[i]
+					}
+					want = codec.Decode(scratch, 0)
+				}
+				if got := codec.Decode(row, x); got != want {
+					t.Fatalf("shape %d: pixel (%d,%d) got %v, want %v", shape, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPointFilterProcessTo(t *testing.T) {
+	src := newRandomImage(newRand(), 33, 9, pix.ShapeRGB888)
+	roi := image.Rect(4, 2, 30, 8)
+	filter := NewGrayscalePerPixel(GrayscaleLuminance)
+	want := make([]byte, 3*roi.Dx()*roi.Dy())
+	wantDims, err := filter.Process(want, src, &roi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hide ProcessTo method to test the buffered fallback of pix.ProcessTo.
+	fallback := struct{ pix.Filter }{filter}
+	for _, f := range []pix.Filter{filter, fallback} {
+		file, err := os.CreateTemp(t.TempDir(), "pix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstDims := wantDims
+		dstDims.Stride += 5
+		w, err := pix.NewImageWriter(file, dstDims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotDims, err := pix.ProcessTo(w, f, readerImage{src}, &roi)
+		if err != nil {
+			t.Fatal(err)
+		} else if gotDims != dstDims {
+			t.Errorf("got dims %+v, want %+v", gotDims, dstDims)
+		}
+		for y := 0; y < wantDims.Height; y++ {
+			row := make([]byte, wantDims.SizeRow())
+			_, err = file.ReadAt(row, int64(y*dstDims.Stride))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRow := want[y*wantDims.Stride : y*wantDims.Stride+wantDims.SizeRow()]
+			if !bytes.Equal(row, wantRow) {
+				t.Errorf("%T: row %d mismatch", f, y)
+			}
+		}
+		file.Close()
+	}
+}
+
+func TestPointFilterParallel(t *testing.T) {
+	const width, height = 37, 29
+	roi := image.Rect(3, 2, 35, 27)
+	for _, shape := range allShapes {
+		convert, err := NewConvert(pix.ShapeRGB565BE, shape)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := newRandomImage(newRand(), width, height, shape)
+		want := make([]byte, 2*width*height)
+		_, err = convert.Process(want, src, &roi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{2, 3, 8, 64} {
+			convert.Workers = workers
+			for _, img := range []pix.Image{src, readerImage{src}} {
+				got := make([]byte, len(want))
+				_, err = convert.Process(got, img, &roi)
+				if err != nil {
+					t.Fatal(err)
+				} else if !bytes.Equal(got, want) {
+					t.Fatalf("shape %d workers=%d: parallel output differs from serial", shape, workers)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkPointFilterWorkers(b *testing.B) {
+	const width, height = 3000, 2000
+	src := newRandomImage(newRand(), width, height, pix.ShapeRGB888)
+	dst := make([]byte, 3*width*height)
+	filter := NewGrayscalePerPixel(GrayscaleLuminance)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			filter.Workers = workers
+			b.SetBytes(3 * width * height)
+			for i := 0; i < b.N; i++ {
+				_, err := filter.Process(dst, src, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPointFilterProcessContextParallel(t *testing.T) {
+	src := newRandomImage(newRand(), 16, 64, pix.ShapeRGB888)
+	dst := make([]byte, 3*16*64)
+	filter := NewInvertedPerPixel()
+	filter.Workers = 4
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := 0
+	_, err := filter.ProcessContext(ctx, dst, src, nil, func(rowsDone, rowsTotal int) {
+		done = rowsDone
+		if rowsTotal != 64 {
+			t.Fatalf("got rowsTotal %d, want 64", rowsTotal)
+		} else if rowsDone == 10 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled error, got %v", err)
+	} else if done >= 64 {
+		t.Errorf("all rows processed despite cancellation")
+	}
+}
+
+func TestPointFilterLazyImage(t *testing.T) {
+	const width, height = 19, 11
+	rect := image.Rect(2, 1, 17, 10)
+	_, stages := newTestPipeline(t)
+	src := newRandomImage(newRand(), width, height, pix.ShapeRGB888)
+	want := processChained(t, stages, readerImage{src}, &rect)
+
+	// Chain lazy images so rows are pulled through every stage on demand.
+	var img pix.Image = readerImage{src}
+	for i, stage := range stages {
+		roi := &rect
+		if i > 0 {
+			roi = nil
+		}
+		lazy, err := pix.NewLazyImage(stage, img, roi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img = lazy
+	}
+	dims := img.Dims()
+	if dims.Width != rect.Dx() || dims.Height != rect.Dy() || dims.Shape != pix.ShapeRGB565BE {
+		t.Fatalf("unexpected lazy dims %+v", dims)
+	}
+	// Read in chunks that straddle row boundaries.
+	got := make([]byte, dims.Size())
+	for off := 0; off < len(got); off += 7 {
+		n, err := img.ReadAt(got[off:min(off+7, len(got))], int64(off))
+		if err != nil || n != min(7, len(got)-off) {
+			t.Fatalf("ReadAt(%d): n=%d err=%v", off, n, err)
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("lazy image output does not match processed output")
+	}
+	_, err := img.ReadAt(got[:1], dims.Size())
+	if err != io.EOF {
+		t.Errorf("want io.EOF reading past end, got %v", err)
+	}
+
+	// Filters without row access are processed in full on first read.
+	dither, err := NewDither(pix.ShapeMonochrome, pix.ShapeRGB888, DitherFloydSteinberg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = make([]byte, (width+7)/8*height)
+	_, err = dither.Process(want, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := pix.NewLazyImage(dither, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = make([]byte, lazy.Dims().Size())
+	_, err = lazy.ReadAt(got, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, want) {
+		t.Error("lazy dither output does not match processed output")
+	}
+}
@@ -0,0 +1,232 @@
+package filters
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/soypat/pix"
+)
+
+// maxRankRadius keeps histogram counts of a full window within uint16.
+const maxRankRadius = 127
+
+// NewMedian creates a median filter over the (2*radius+1)x(2*radius+1) neighborhood of every pixel.
+// It removes salt-and-pepper noise while preserving edges. See [NewPercentile] for supported shapes.
+func NewMedian(shape pix.Shape, radius int) (*NeighborhoodFilter, error) {
+	percentile := float32(50)
+	return newRank(shape, radius, &percentile)
+}
+
+// NewMinFilter creates a filter which outputs the minimum of the (2*radius+1)x(2*radius+1) neighborhood of every pixel.
+// It is the grayscale erosion with a square structuring element. See [NewPercentile] for supported shapes.
+func NewMinFilter(shape pix.Shape, radius int) (*NeighborhoodFilter, error) {
+	percentile := float32(0)
+	return newRank(shape, radius, &percentile)
+}
+
+// NewMaxFilter creates a filter which outputs the maximum of the (2*radius+1)x(2*radius+1) neighborhood of every pixel.
+// It is the grayscale dilation with a square structuring element. See [NewPercentile] for supported shapes.
+func NewMaxFilter(shape pix.Shape, radius int) (*NeighborhoodFilter, error) {
+	percentile := float32(100)
+	return newRank(shape, radius, &percentile)
+}
+
+// NewPercentile creates a rank filter which outputs the given percentile, 0 to 100, of the values of
+// each channel over the (2*radius+1)x(2*radius+1) neighborhood of every pixel. Percentile 0 is the minimum,
+// 50 the median and 100 the maximum. The percentile can be changed with the filter's controls.
+//
+// 8-bit shapes (Grayscale8bit, RGB888 and RGBA8888) use a constant-time algorithm which keeps a histogram per column
+// updated as the window slides down, so the cost per pixel does not depend on radius. Small radii
+// update the neighborhood histogram with the pixels entering and leaving it which is cheaper.
+// Grayscale16BE sorts the neighborhood of every pixel. Border defaults to [BorderMirror].
+func NewPercentile(shape pix.Shape, radius int, percentile float32) (*NeighborhoodFilter, error) {
+	f, err := newRank(shape, radius, &percentile)
+	if err != nil {
+		return nil, err
+	}
+	f.Ctrls = append(f.Ctrls, &pix.ControlOrdered[float32]{
+		Name:        "Percentile",
+		Description: "Percentile of the neighborhood values output, 50 is the median",
+		Value:       percentile,
+		Min:         0,
+		Max:         100,
+		Step:        1,
+		OnChange: func(v float32) error {
+			percentile = v
+			return nil
+		},
+	})
+	return f, nil
+}
+
+// rankIndex returns the zero based index of the percentile within n sorted values.
+func rankIndex(percentile float32, n int) int {
+	return int(math.Round(float64(percentile) / 100 * float64(n-1)))
+}
+
+// newRank creates a rank filter which reads the percentile through a pointer so controls may change it.
+func newRank(shape pix.Shape, radius int, percentile *float32) (*NeighborhoodFilter, error) {
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if radius < 0 || radius > maxRankRadius {
+		return nil, errors.New("rank filter radius out of range 0..127")
+	} else if *percentile < 0 || *percentile > 100 {
+		return nil, errors.New("percentile out of range 0..100")
+	}
+	f := &NeighborhoodFilter{
+		In:     shape,
+		Out:    shape,
+		Border: BorderMirror,
+	}
+	if bpc == 1 {
+		// The window holds one extra row above to remove it from the column histograms.
+		f.Radius = radius + 1
+		f.Fn = func(dst []byte, win *Window) {
+			rankHistogramRow(dst, win, channels, win.Radius-1, *percentile)
+		}
+	} else {
+		f.Radius = radius
+		var pool sync.Pool
+		f.Fn = func(dst []byte, win *Window) {
+			rankSortRow(dst, win, channels, bpc, &pool, *percentile)
+		}
+	}
+	f.Ctrls = []pix.Control{
+		&pix.ControlOrdered[int]{
+			Name:        "Radius",
+			Description: "Number of neighbor pixels on each side of the ranked neighborhood",
+			Value:       radius,
+			Min:         0,
+			Max:         maxRankRadius,
+			Step:        1,
+			OnChange: func(v int) error {
+				f.Radius = v
+				if bpc == 1 {
+					f.Radius++
+				}
+				return nil
+			},
+		},
+	}
+	return f, nil
+}
+
+// columnHistograms holds a 256 bin histogram per channel of every padded window column of a band.
+type columnHistograms []uint16
+
+// rankHistogramRow computes a row of the percentile of 8-bit samples over radius with
+// column histograms stored in the window state. The window radius must be radius+1.
+func rankHistogramRow(dst []byte, win *Window, channels, radius int, percentile float32) {
+	n := (win.Width + 2*win.Radius) * channels
+	hists, _ := win.State.(columnHistograms)
+	if hists == nil {
+		hists = make(columnHistograms, 256*n)
+		for dy := -radius; dy <= radius; dy++ {
+			row := win.Row(dy)
+			for i, v := range row[:n] {
+				hists[i*256+int(v)]++
+			}
+		}
+		win.State = hists
+	} else {
+		add, sub := win.Row(radius), win.Row(-radius-1)
+		for i := range n {
+			hists[i*256+int(sub[i])]--
+			hists[i*256+int(add[i])]++
+		}
+	}
+	side := 2*radius + 1
+	k := uint32(rankIndex(percentile, side*side))
+	// Neighborhood histogram and its coarse 16 bin histogram to find the rank in at most 32 steps.
+	var kernel [256]uint32
+	var coarse [16]uint32
+	for c := 0; c < channels; c++ {
+		// Output pixel x ranks padded columns x+1 to x+2*radius+1.
+		clear(kernel[:])
+		clear(coarse[:])
+		for j := 1; j <= side; j++ {
+			col := hists[(j*channels+c)*256:][:256]
+			for v, count := range col {
+				kernel[v] += uint32(count)
+				coarse[v>>4] += uint32(count)
+			}
+		}
+		for x := 0; x < win.Width; x++ {
+			var cum uint32
+			bin := 0
+			for ; bin < 15 && cum+coarse[bin] <= k; bin++ {
+				cum += coarse[bin]
+			}
+			v := bin << 4
+			for ; v < 255; v++ {
+				cum += kernel[v]
+				if cum > k {
+					break
+				}
+			}
+			dst[x*channels+c] = byte(v)
+			if x+1 == win.Width {
+				break
+			}
+			addCol, subCol := (x+side+1)*channels+c, (x+1)*channels+c
+			if 2*side < 256 {
+				// Cheaper to update with the column pixels than with the column histograms.
+				for dy := -radius; dy <= radius; dy++ {
+					row := win.Row(dy)
+					add, sub := row[addCol], row[subCol]
+					kernel[add]++
+					kernel[sub]--
+					coarse[add>>4]++
+					coarse[sub>>4]--
+				}
+				continue
+			}
+			add, sub := hists[addCol*256:][:256], hists[subCol*256:][:256]
+			for v := range kernel {
+				d := uint32(add[v]) - uint32(sub[v])
+				kernel[v] += d
+				coarse[v>>4] += d
+			}
+		}
+	}
+	if channels == 4 {
+		clampPremultiplied(dst[:4*win.Width])
+	}
+}
+
+// rankSortRow computes a row of the percentile of samples by sorting the neighborhood of each pixel.
+func rankSortRow(dst []byte, win *Window, channels, bpc int, pool *sync.Pool, percentile float32) {
+	radius := win.Radius
+	side := 2*radius + 1
+	values, _ := pool.Get().(*[]int32)
+	if values == nil {
+		values = new([]int32)
+	}
+	k := rankIndex(percentile, side*side)
+	for x := 0; x < win.Width; x++ {
+		for c := 0; c < channels; c++ {
+			vals := (*values)[:0]
+			for dy := -radius; dy <= radius; dy++ {
+				row := win.Row(dy)
+				for dx := 0; dx < side; dx++ {
+					vals = append(vals, loadSample(row, (x+dx)*channels+c, bpc))
+				}
+			}
+			slices.Sort(vals)
+			storeSample(dst, x*channels+c, bpc, vals[k])
+			*values = vals
+		}
+	}
+	pool.Put(values)
+}
+
+// clampPremultiplied clamps color channels of RGBA8888 pixels to their alpha.
+func clampPremultiplied(row []byte) {
+	for i := 0; i+3 < len(row); i += 4 {
+		a := row[i+3]
+		row[i], row[i+1], row[i+2] = min(row[i], a), min(row[i+1], a), min(row[i+2], a)
+	}
+}
@@ -0,0 +1,106 @@
+package filters
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+// naiveRank is the sorting reference of the rank filters over rect.
+func naiveRank(img *testImage, radius int, percentile float32, r image.Rectangle) []byte {
+	d := img.dims
+	channels, bpc, _ := kernelLayout(d.Shape)
+	out := make([]byte, r.Dx()*r.Dy()*channels*bpc)
+	side := 2*radius + 1
+	k := rankIndex(percentile, side*side)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for c := 0; c < channels; c++ {
+				var vals []int32
+				for dy := -radius; dy <= radius; dy++ {
+					for dx := -radius; dx <= radius; dx++ {
+						sx := borderIndex(x+dx, d.Width, BorderMirror)
+						sy := borderIndex(y+dy, d.Height, BorderMirror)
+						vals = append(vals, loadSample(img.buf[sy*d.Stride:], sx*channels+c, bpc))
+					}
+				}
+				slices.Sort(vals)
+				storeSample(out, ((y-r.Min.Y)*r.Dx()+x-r.Min.X)*channels+c, bpc, vals[k])
+			}
+		}
+	}
+	return out
+}
+
+func TestRankFilters(t *testing.T) {
+	const width, height = 17, 14
+	rect := image.Rect(2, 3, 16, 12)
+	for _, shape := range []pix.Shape{pix.ShapeGrayscale8bit, pix.ShapeGrayscale16BE, pix.ShapeRGB888} {
+		for _, radius := range []int{0, 1, 3} {
+			f, err := NewPercentile(shape, 1, 50)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = f.Controls()[0].ChangeValue(radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Workers = 2
+			for _, percentile := range []float32{0, 30, 50, 100} {
+				err = f.Controls()[1].ChangeValue(percentile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				img := newRandomImage(newRand(), width, height, shape)
+				want := naiveRank(img, radius, percentile, rect)
+				got := processFilter(t, f, readerImage{img}, &rect)
+				if d := maxDiff(got, want); d != 0 {
+					t.Errorf("shape %d radius %d percentile %v: differs by %d", shape, radius, percentile, d)
+				}
+			}
+		}
+	}
+}
+
+func TestMedianSaltAndPepper(t *testing.T) {
+	const width, height = 16, 16
+	img := &testImage{dims: pix.Dims{Width: width, Height: height, Stride: width, Shape: pix.ShapeGrayscale8bit}, buf: make([]byte, width*height)}
+	for i := range img.buf {
+		img.buf[i] = 100
+	}
+	for _, i := range []int{17, 40, 99, 150, 200} {
+		img.buf[i] = 255 * byte(i%2)
+	}
+	f, err := NewMedian(pix.ShapeGrayscale8bit, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Process(nil, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range img.buf {
+		if v != 100 {
+			t.Fatalf("noise remains at %d: %d", i, v)
+		}
+	}
+}
+
+func BenchmarkMedian(b *testing.B) {
+	img := newRandomImage(newRand(), 320, 240, pix.ShapeGrayscale8bit)
+	dst := make([]byte, img.dims.Size())
+	for _, radius := range []int{2, 20} {
+		f, err := NewMedian(pix.ShapeGrayscale8bit, radius)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("radius=%d", radius), func(b *testing.B) {
+			for b.Loop() {
+				f.Process(dst, img, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/soypat/pix"
+)
+
+// ResizeKernel is the interpolation kernel used by [Resize] to compute output pixels from source pixels.
+type ResizeKernel int
+
+const (
+	// ResizeNearest copies the source pixel nearest to each output pixel. Fastest, produces blocky upscales and aliased downscales.
+	ResizeNearest ResizeKernel = iota
+	// ResizeBilinear interpolates linearly between the nearest source pixels.
+	ResizeBilinear
+	// ResizeCatmullRom is the Catmull-Rom cubic spline. Sharper than bilinear with slight ringing on edges.
+	ResizeCatmullRom
+	// ResizeMitchell is the Mitchell-Netravali cubic with B=C=1/3 which trades ringing for slight blur.
+	ResizeMitchell
+	// ResizeArea averages the source pixels covered by each output pixel weighted by their overlap.
+	// It is the preferred kernel for downscaling and behaves like nearest with antialiased borders when upscaling.
+	ResizeArea
+	// ResizeLanczos3 is the sinc function windowed to 3 lobes. Sharpest kernel at the cost of ringing on edges.
+	ResizeLanczos3
+)
+
+func (k ResizeKernel) String() string {
+	switch k {
+	case ResizeNearest:
+		return "Nearest"
+	case ResizeBilinear:
+		return "Bilinear"
+	case ResizeCatmullRom:
+		return "Catmull-Rom"
+	case ResizeMitchell:
+		return "Mitchell"
+	case ResizeArea:
+		return "Area"
+	case ResizeLanczos3:
+		return "Lanczos3"
+	default:
+		return "Unknown"
+	}
+}
+
+// weight returns the kernel's radius in pixels and its weight as a function of the distance to the sampled point.
+// Nearest and area kernels are computed separately and return a nil function.
+func (k ResizeKernel) weight() (support float64, fn func(x float64) float64) {
+	switch k {
+	case ResizeBilinear:
+		return 1, func(x float64) float64 { return max(0, 1-math.Abs(x)) }
+	case ResizeCatmullRom:
+		return 2, cubicKernel(0, 0.5)
+	case ResizeMitchell:
+		return 2, cubicKernel(1./3, 1./3)
+	case ResizeLanczos3:
+		return 3, func(x float64) float64 {
+			if x == 0 {
+				return 1
+			} else if x <= -3 || x >= 3 {
+				return 0
+			}
+			px := math.Pi * x
+			return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+		}
+	}
+	return 0, nil
+}
+
+// cubicKernel returns the Mitchell-Netravali family cubic with parameters b and c.
+func cubicKernel(b, c float64) func(x float64) float64 {
+	return func(x float64) float64 {
+		x = math.Abs(x)
+		switch {
+		case x < 1:
+			return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+		case x < 2:
+			return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+		}
+		return 0
+	}
+}
+
+// resizeAxis holds the contribution of source pixels to output pixels along one axis.
+// Output pixel i is the weighted sum of taps consecutive source pixels starting at start[i].
+type resizeAxis struct {
+	start   []int
+	taps    int
+	weights []float32
+}
+
+// newResizeAxis computes the weights resampling srcN pixels to dstN pixels. Pixel i covers the interval [i,i+1)
+// so image corners are aligned. When downscaling kernels are stretched by the scale factor to avoid aliasing.
+// Weights of source pixels outside the image are dropped and the remaining weights normalized to sum 1.
+func newResizeAxis(kernel ResizeKernel, srcN, dstN int) resizeAxis {
+	scale := float64(srcN) / float64(dstN)
+	support, fn := kernel.weight()
+	fscale := max(scale, 1)
+	var taps int
+	switch kernel {
+	case ResizeNearest:
+		taps = 1
+	case ResizeArea:
+		taps = int(math.Ceil(scale)) + 1
+	default:
+		support *= fscale
+		taps = int(math.Ceil(2*support)) + 1
+	}
+	taps = min(taps, srcN)
+	ax := resizeAxis{start: make([]int, dstN), taps: taps, weights: make([]float32, dstN*taps)}
+	ws := make([]float64, taps)
+	for i := range dstN {
+		var lo, hi int
+		clear(ws)
+		switch kernel {
+		case ResizeNearest:
+			lo = min(int((float64(i)+0.5)*scale), srcN-1)
+			hi = lo + 1
+		case ResizeArea:
+			x0, x1 := float64(i)*scale, float64(i+1)*scale
+			lo, hi = int(x0), min(int(math.Ceil(x1)), srcN)
+		default:
+			center := (float64(i) + 0.5) * scale
+			lo = max(int(math.Floor(center-support)), 0)
+			hi = min(int(math.Ceil(center+support)), srcN)
+		}
+		start := max(0, min(lo, srcN-taps))
+		var sum float64
+		for j := lo; j < hi; j++ {
+			var w float64
+			switch kernel {
+			case ResizeNearest:
+				w = 1
+			case ResizeArea:
+				w = min(float64(j+1), float64(i+1)*scale) - max(float64(j), float64(i)*scale)
+			default:
+				w = fn((float64(j) + 0.5 - (float64(i)+0.5)*scale) / fscale)
+			}
+			ws[j-start] = w
+			sum += w
+		}
+		ax.start[i] = start
+		for k, w := range ws {
+			ax.weights[i*taps+k] = float32(w / sum)
+		}
+	}
+	return ax
+}
+
+// resample writes the resampled pixels of src, which has channels interleaved samples per pixel, to dst.
+func (ax *resizeAxis) resample(dst, src []float32, channels int) {
+	var acc [4]float32
+	for i, start := range ax.start {
+		s := src[start*channels:]
+		clear(acc[:])
+		for k, w := range ax.weights[i*ax.taps : (i+1)*ax.taps] {
+			for c := 0; c < channels; c++ {
+				acc[c] += w * s[k*channels+c]
+			}
+		}
+		copy(dst[i*channels:], acc[:channels])
+	}
+}
+
+// floatLayout converts rows of a byte-aligned shape to interleaved float32 channels and back.
+// Shapes supported by [NewConvolve] are read in their native sample range, others are converted
+// to 16 bit RGBA through their codec.
+type floatLayout struct {
+	channels int
+	bpc      int // Bytes per channel, 0 for shapes converted with codec.
+	codec    pix.Codec
+}
+
+func newFloatLayout(shape pix.Shape) (floatLayout, error) {
+	bits := shape.BitsPerPixel()
+	codec, ok := shape.Codec()
+	if !ok || bits%8 != 0 {
+		return floatLayout{}, errors.New("filter requires a byte-aligned shape")
+	}
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return floatLayout{channels: 4, codec: codec}, nil
+	}
+	return floatLayout{channels: channels, bpc: bpc}, nil
+}
+
+// load converts the first len(dst)/channels pixels of row to float32 samples.
+func (l *floatLayout) load(dst []float32, row []byte) {
+	if l.bpc != 0 {
+		for i := range dst {
+			dst[i] = float32(loadSample(row, i, l.bpc))
+		}
+		return
+	}
+	for x := range len(dst) / 4 {
+		c := l.codec.Decode(row, x)
+		dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = float32(c.R), float32(c.G), float32(c.B), float32(c.A)
+	}
+}
+
+// store rounds and clamps float32 samples and writes them as pixels to row.
+func (l *floatLayout) store(row []byte, src []float32) {
+	if l.bpc != 0 {
+		for x := range len(src) / l.channels {
+			storePixel(row, x, src[x*l.channels:(x+1)*l.channels], l.bpc)
+		}
+		return
+	}
+	for x := range len(src) / 4 {
+		px := src[4*x : 4*x+4]
+		a := uint16(max(0, min(px[3], 0xffff)) + 0.5)
+		l.codec.Encode(row, x, color.RGBA64{
+			R: clampAlpha(int32(px[0]+0.5), a),
+			G: clampAlpha(int32(px[1]+0.5), a),
+			B: clampAlpha(int32(px[2]+0.5), a),
+			A: a,
+		})
+	}
+}
+
+// Resize is a filter which scales the source image or ROI to a fixed width and height
+// with a separable [ResizeKernel]. Rows are resized horizontally as they are read and combined
+// vertically so only as many source rows as the kernel spans are kept in memory,
+// which allows resizing streamed images larger than memory with [Resize.ProcessTo] or a [pix.LazyImage].
+//
+// Resize supports all byte-aligned shapes and does not support in-place processing.
+type Resize struct {
+	shape         pix.Shape
+	width, height int
+	kernel        ResizeKernel
+	layout        floatLayout
+	ctrls         []pix.Control
+}
+
+var _ pix.DimsFilter = (*Resize)(nil)
+
+// NewResize creates a filter which resizes images of the given shape to width x height pixels using kernel.
+// Width, height and kernel can be changed with the filter's controls.
+func NewResize(shape pix.Shape, width, height int, kernel ResizeKernel) (*Resize, error) {
+	layout, err := newFloatLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if width <= 0 || height <= 0 {
+		return nil, errors.New("resize dimensions must be positive")
+	} else if kernel < ResizeNearest || kernel > ResizeLanczos3 {
+		return nil, errors.New("invalid resize kernel")
+	}
+	rz := &Resize{shape: shape, width: width, height: height, kernel: kernel, layout: layout}
+	rz.ctrls = []pix.Control{
+		&pix.ControlOrdered[int]{
+			Name:        "Width",
+			Description: "Width in pixels of the resized image",
+			Value:       width,
+			Min:         1,
+			Max:         math.MaxUint16,
+			Step:        1,
+			OnChange: func(v int) error {
+				rz.width = v
+				return nil
+			},
+		},
+		&pix.ControlOrdered[int]{
+			Name:        "Height",
+			Description: "Height in pixels of the resized image",
+			Value:       height,
+			Min:         1,
+			Max:         math.MaxUint16,
+			Step:        1,
+			OnChange: func(v int) error {
+				rz.height = v
+				return nil
+			},
+		},
+		&pix.ControlEnum[ResizeKernel]{
+			Name:        "Kernel",
+			Description: "Interpolation kernel computing output pixels from source pixels",
+			Value:       kernel,
+			ValidValues: []ResizeKernel{ResizeNearest, ResizeBilinear, ResizeCatmullRom, ResizeMitchell, ResizeArea, ResizeLanczos3},
+			OnChange: func(k ResizeKernel) error {
+				rz.kernel = k
+				return nil
+			},
+		},
+	}
+	return rz, nil
+}
+
+// ShapeIO implements [pix.Filter].
+func (rz *Resize) ShapeIO() (output, input pix.Shape) {
+	return rz.shape, rz.shape
+}
+
+// Controls implements [pix.Filter].
+func (rz *Resize) Controls() []pix.Control {
+	return rz.ctrls
+}
+
+// OutputDims implements [pix.DimsFilter]. The output size does not depend on src or roi.
+func (rz *Resize) OutputDims(src pix.Dims, roi *image.Rectangle) (pix.Dims, error) {
+	if src.Shape != rz.shape {
+		return pix.Dims{}, errShapeMismatch
+	}
+	d := pix.Dims{Width: rz.width, Height: rz.height, Shape: rz.shape}
+	d.Stride = d.SizeRow()
+	return d, nil
+}
+
+// Process implements [pix.Filter]. dst must not be nil and output rows are packed.
+func (rz *Resize) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	return rz.ProcessContext(context.Background(), dst, src, roi, nil)
+}
+
+// ProcessContext implements [pix.ContextFilter]. ctx is checked between output rows.
+func (rz *Resize) ProcessContext(ctx context.Context, dst []byte, src pix.Image, roi *image.Rectangle, progress pix.ProgressFunc) (pix.Dims, error) {
+	if dst == nil {
+		return pix.Dims{}, errors.New("resize does not support in-place processing")
+	}
+	outDims, r, err := rz.validate(src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	} else if int64(len(dst)) < outDims.Size() {
+		return pix.Dims{}, errors.New("destination buffer not large enough to store output")
+	}
+	err = rz.rows(ctx, src, r, 0, outDims.Height, progress, func(y int, row []byte) error {
+		copy(dst[y*outDims.Stride:], row)
+		return nil
+	})
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	return outDims, nil
+}
+
+// ProcessTo implements [pix.StreamFilter]. Only the source rows spanned by the kernel
+// and a single output row are kept in memory.
+func (rz *Resize) ProcessTo(dst pix.ImageWriter, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	outDims, r, err := rz.validate(src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	dstDims, _, err := pix.ValidateWriterArgs(dst, outDims, src, roi)
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	err = rz.rows(context.Background(), src, r, 0, outDims.Height, nil, func(y int, row []byte) error {
+		_, err := dst.WriteAt(row, int64(y)*int64(dstDims.Stride))
+		return err
+	})
+	if err != nil {
+		return pix.Dims{}, err
+	}
+	outDims.Stride = dstDims.Stride
+	return outDims, nil
+}
+
+// ProcessRows implements [pix.RowProcessor]. Only the source rows contributing to output rows y0 to y1 are read.
+func (rz *Resize) ProcessRows(dst []byte, stride int, src pix.Image, roi *image.Rectangle, y0, y1 int) error {
+	outDims, r, err := rz.validate(src, roi)
+	if err != nil {
+		return err
+	} else if y0 < 0 || y1 > outDims.Height || y0 >= y1 {
+		return errors.New("invalid row range")
+	} else if stride < outDims.SizeRow() || len(dst) < (y1-y0-1)*stride+outDims.SizeRow() {
+		return errors.New("destination buffer not large enough to store output")
+	}
+	return rz.rows(context.Background(), src, r, y0, y1, nil, func(y int, row []byte) error {
+		copy(dst[(y-y0)*stride:], row)
+		return nil
+	})
+}
+
+// validate checks src and roi and returns the output dimensions and the source region to resize.
+func (rz *Resize) validate(src pix.Image, roi *image.Rectangle) (pix.Dims, image.Rectangle, error) {
+	srcDims := src.Dims()
+	if srcDims.Shape != rz.shape {
+		return pix.Dims{}, image.Rectangle{}, errShapeMismatch
+	}
+	outDims, err := pix.OutputDims(rz, srcDims, roi)
+	if err != nil {
+		return pix.Dims{}, image.Rectangle{}, err
+	}
+	r := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	if roi != nil {
+		r = *roi
+	}
+	return outDims, r, nil
+}
+
+// rows computes output rows y0 to y1 of resizing region r of src and passes them to sink in order.
+func (rz *Resize) rows(ctx context.Context, src pix.Image, r image.Rectangle, y0, y1 int, progress pix.ProgressFunc, sink func(y int, row []byte) error) error {
+	ch := rz.layout.channels
+	xs := newResizeAxis(rz.kernel, r.Dx(), rz.width)
+	ys := newResizeAxis(rz.kernel, r.Dy(), rz.height)
+	srcDims := src.Dims()
+	bpp := srcDims.Shape.BitsPerPixel() / 8
+	rowBuf := make([]byte, srcDims.SizeRow())
+	line := make([]float32, r.Dx()*ch)
+	// Horizontally resized source rows are kept in a ring indexed by source row modulo taps.
+	// Source rows needed by consecutive output rows never decrease so rows are read at most once.
+	ring := make([][]float32, ys.taps)
+	ringRow := make([]int, ys.taps)
+	for i := range ring {
+		ring[i] = make([]float32, rz.width*ch)
+		ringRow[i] = -1
+	}
+	acc := make([]float32, rz.width*ch)
+	out := make([]byte, (pix.Dims{Width: rz.width, Shape: rz.shape}).SizeRow())
+	for y := y0; y < y1; y++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		clear(acc)
+		for k, w := range ys.weights[y*ys.taps : (y+1)*ys.taps] {
+			if w == 0 {
+				continue
+			}
+			sy := ys.start[y] + k
+			slot := sy % ys.taps
+			if ringRow[slot] != sy {
+				srcRow, err := pix.ImageRow(rowBuf, src, r.Min.Y+sy)
+				if err != nil {
+					return err
+				}
+				rz.layout.load(line, srcRow[r.Min.X*bpp:])
+				xs.resample(ring[slot], line, ch)
+				ringRow[slot] = sy
+			}
+			for i, v := range ring[slot] {
+				acc[i] += w * v
+			}
+		}
+		rz.layout.store(out, acc)
+		if err := sink(y, out); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(y-y0+1, y1-y0)
+		}
+	}
+	return nil
+}
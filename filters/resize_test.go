@@ -0,0 +1,226 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+var resizeKernels = []ResizeKernel{ResizeNearest, ResizeBilinear, ResizeCatmullRom, ResizeMitchell, ResizeArea, ResizeLanczos3}
+
+// byteAlignedShapes are the shapes supported by [Resize].
+var byteAlignedShapes = []pix.Shape{
+	pix.ShapeRGB888, pix.ShapeRGBA8888, pix.ShapeRGB565BE, pix.ShapeNRGBA8888, pix.ShapeGrayscale8bit, pix.ShapeGrayscale16BE,
+}
+
+// sliceWriterAt is an in-memory [io.WriterAt].
+type sliceWriterAt []byte
+
+func (s sliceWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(s)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(s[off:], p), nil
+}
+
+func TestResizeIdentity(t *testing.T) {
+	for _, shape := range byteAlignedShapes {
+		img := newRandomImage(newRand(), 13, 9, shape)
+		premultiply(img)
+		var want []byte
+		for y := 0; y < img.dims.Height; y++ {
+			want = append(want, img.buf[y*img.dims.Stride:][:img.dims.SizeRow()]...)
+		}
+		for _, kernel := range resizeKernels {
+			if kernel == ResizeMitchell {
+				continue // Mitchell is not interpolating and smooths the image.
+			}
+			rz, err := NewResize(shape, 13, 9, kernel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := processFilter(t, rz, img, nil)
+			if d := maxDiff(got, want); d > 0 {
+				t.Errorf("shape %d kernel %s: same size resize differs by %d", shape, kernel, d)
+			}
+		}
+	}
+}
+
+func TestResizeUniform(t *testing.T) {
+	for _, shape := range byteAlignedShapes {
+		img := newRandomImage(newRand(), 7, 5, shape)
+		// Fill with the first pixel.
+		bpp := shape.BitsPerPixel() / 8
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 7; x++ {
+				copy(img.buf[y*img.dims.Stride+x*bpp:][:bpp], img.buf[:bpp])
+			}
+		}
+		premultiply(img)
+		for _, kernel := range resizeKernels {
+			for _, size := range []image.Point{{3, 2}, {16, 11}, {7, 13}} {
+				rz, err := NewResize(shape, size.X, size.Y, kernel)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := processFilter(t, rz, img, nil)
+				for i := 0; i < len(got); i += bpp {
+					if !bytes.Equal(got[i:i+bpp], img.buf[:bpp]) {
+						t.Fatalf("shape %d kernel %s size %v: pixel %d got %v, want %v", shape, kernel, size, i/bpp, got[i:i+bpp], img.buf[:bpp])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResizeAreaHalf(t *testing.T) {
+	const width, height = 10, 6
+	img := newRandomImage(newRand(), width, height, pix.ShapeGrayscale8bit)
+	rz, err := NewResize(pix.ShapeGrayscale8bit, width/2, height/2, ResizeArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := processFilter(t, rz, img, nil)
+	stride := img.dims.Stride
+	for y := 0; y < height/2; y++ {
+		for x := 0; x < width/2; x++ {
+			i := 2*y*stride + 2*x
+			sum := int(img.buf[i]) + int(img.buf[i+1]) + int(img.buf[i+stride]) + int(img.buf[i+stride+1])
+			want := (sum + 2) / 4
+			if d := int(got[y*width/2+x]) - want; d < -1 || d > 1 {
+				t.Errorf("pixel (%d,%d) got %d, want average %d", x, y, got[y*width/2+x], want)
+			}
+		}
+	}
+}
+
+func TestResizeStreaming(t *testing.T) {
+	for _, shape := range byteAlignedShapes {
+		img := newRandomImage(newRand(), 23, 17, shape)
+		premultiply(img)
+		roi := image.Rect(2, 3, 21, 16)
+		sub, err := pix.SubImage(img, roi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, kernel := range resizeKernels {
+			for _, size := range []image.Point{{8, 5}, {31, 29}} {
+				rz, err := NewResize(shape, size.X, size.Y, kernel)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := processFilter(t, rz, sub, nil)
+				got := processFilter(t, rz, readerImage{img}, &roi)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("shape %d kernel %s: ROI resize differs from resize of sub-image", shape, kernel)
+				}
+
+				lazy, err := pix.NewLazyImage(rz, readerImage{img}, &roi)
+				if err != nil {
+					t.Fatal(err)
+				} else if d := lazy.Dims(); d.Width != size.X || d.Height != size.Y {
+					t.Fatalf("lazy image dims %dx%d, want %v", d.Width, d.Height, size)
+				}
+				got, err = io.ReadAll(io.NewSectionReader(lazy, 0, lazy.Dims().Size()))
+				if err != nil {
+					t.Fatal(err)
+				} else if !bytes.Equal(got, want) {
+					t.Fatalf("shape %d kernel %s: lazy resize differs", shape, kernel)
+				}
+
+				d, _ := pix.OutputDims(rz, img.dims, &roi)
+				d.Stride += 5
+				buf := make(sliceWriterAt, d.Size())
+				w, err := pix.NewImageWriter(buf, d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = rz.ProcessTo(w, readerImage{img}, &roi)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for y := 0; y < d.Height; y++ {
+					if !bytes.Equal(buf[y*d.Stride:][:d.SizeRow()], want[y*d.SizeRow():][:d.SizeRow()]) {
+						t.Fatalf("shape %d kernel %s: ProcessTo row %d differs", shape, kernel, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResizePipeline(t *testing.T) {
+	rz, err := NewResize(pix.ShapeRGB888, 12, 8, ResizeBilinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := []pix.Filter{NewGrayscalePerPixel(GrayscaleAverage), rz, NewInvertedPerPixel()}
+	p, err := NewPipeline(stages...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newRandomImage(newRand(), 17, 11, pix.ShapeRGB888)
+	roi := image.Rect(1, 2, 15, 11)
+	d, err := pix.OutputDims(p, src.dims, &roi)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Width != 12 || d.Height != 8 {
+		t.Fatalf("pipeline output %dx%d, want 12x8", d.Width, d.Height)
+	}
+	want := processChained(t, stages, src, &roi)
+	got := make([]byte, d.Size())
+	dims, err := p.Process(got, src, &roi)
+	if err != nil {
+		t.Fatal(err)
+	} else if dims != d {
+		t.Errorf("got dims %+v, want %+v", dims, d)
+	} else if !bytes.Equal(got, want) {
+		t.Error("pipeline output differs from chained stages")
+	}
+	err = rz.Controls()[0].ChangeValue(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ = pix.OutputDims(p, src.dims, nil)
+	if d.Width != 20 {
+		t.Errorf("width control not applied, got width %d", d.Width)
+	}
+}
+
+func TestResizeUnsupported(t *testing.T) {
+	if _, err := NewResize(pix.ShapeRGB444BE, 4, 4, ResizeBilinear); err == nil {
+		t.Error("expected error for non byte-aligned shape")
+	}
+	rz, err := NewResize(pix.ShapeRGB888, 4, 4, ResizeBilinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rz.Process(nil, newRandomImage(newRand(), 4, 4, pix.ShapeRGB888), nil); err == nil {
+		t.Error("expected error for in-place resize")
+	}
+}
+
+func BenchmarkResize(b *testing.B) {
+	img := newRandomImage(newRand(), 1920, 1080, pix.ShapeRGB888)
+	for _, kernel := range resizeKernels {
+		rz, err := NewResize(pix.ShapeRGB888, 640, 640, kernel)
+		if err != nil {
+			b.Fatal(err)
+		}
+		dst := make([]byte, 640*640*3)
+		b.Run(kernel.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(img.buf)))
+			for i := 0; i < b.N; i++ {
+				_, err := rz.Process(dst, img, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package filters
+
+import (
+	"context"
+	"image"
+
+	"github.com/soypat/pix"
+)
+
+// ScanFunc processes a contiguous row of pixels like [PointFunc].
+// y is the index of the row within the processed region, starting at 0 for the first row.
+type ScanFunc func(dst, src []byte, y int)
+
+// ScanFilter is a row-stateful counterpart of [PointFilter]. Rows are always processed
+// in scan order, top to bottom, so the callback may carry state from one row to the next
+// such as the error buffers of error diffusion dithering.
+//
+// Since it is stateful a ScanFilter must not be used by multiple goroutines concurrently.
+type ScanFilter struct {
+	In  pix.Shape
+	Out pix.Shape
+	// Begin is called before the first row is processed with the output dimensions
+	// so state from a previous call to Process can be reset. Begin is optional.
+	Begin func(out pix.Dims)
+	Fn    ScanFunc
+	Ctrls []pix.Control // User-defined controls for this filter.
+}
+
+// ShapeIO implements [Filter].
+func (f *ScanFilter) ShapeIO() (output, input pix.Shape) {
+	return f.Out, f.In
+}
+
+// Controls implements [Filter].
+func (f *ScanFilter) Controls() []pix.Control {
+	return f.Ctrls
+}
+
+// Process implements [Filter].
+func (f *ScanFilter) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	if f.Fn == nil {
+		return pix.Dims{}, errNilPixelFunc
+	}
+	return f.job(src, roi).process(dst)
+}
+
+// ProcessContext implements [pix.ContextFilter]. ctx is checked before processing each row.
+func (f *ScanFilter) ProcessContext(ctx context.Context, dst []byte, src pix.Image, roi *image.Rectangle, progress pix.ProgressFunc) (pix.Dims, error) {
+	if f.Fn == nil {
+		return pix.Dims{}, errNilPixelFunc
+	}
+	job := f.job(src, roi)
+	job.ctx, job.progress = ctx, progress
+	return job.process(dst)
+}
+
+// ProcessTo implements [pix.StreamFilter]. Memory usage is bounded to a few rows.
+func (f *ScanFilter) ProcessTo(dst pix.ImageWriter, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	if f.Fn == nil {
+		return pix.Dims{}, errNilPixelFunc
+	}
+	return f.job(src, roi).processTo(dst)
+}
+
+func (f *ScanFilter) job(src pix.Image, roi *image.Rectangle) *rowJob {
+	return &rowJob{
+		src:   src,
+		roi:   roi,
+		out:   f.Out,
+		in:    f.In,
+		begin: f.Begin,
+		fn:    f.Fn,
+	}
+}
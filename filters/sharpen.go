@@ -0,0 +1,149 @@
+package filters
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/soypat/pix"
+)
+
+// blurMask is a neighborhood filter which combines each source pixel with its gaussian blurred
+// value using the same blur as [NewGaussianBlur]. The alpha channel of RGBA8888 is left unchanged.
+type blurMask struct {
+	f      *NeighborhoodFilter
+	k      separableKernel
+	amount float32
+	radius float32
+}
+
+func newBlurMask(shape pix.Shape, radius, amount float32, combine func(src, blurred, maxv float32) float32) (*blurMask, error) {
+	channels, bpc, err := kernelLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if radius < 0 {
+		return nil, errors.New("negative sharpen radius")
+	} else if amount < 0 {
+		return nil, errors.New("negative sharpen amount")
+	}
+	kernel := gaussianKernel(radius)
+	m := &blurMask{k: separableKernel{x: kernel, y: kernel}, amount: amount, radius: radius}
+	maxv := float32(int32(1)<<(8*bpc) - 1)
+	colors := min(channels, 3)
+	// Scratch rows are pooled so the function may be called concurrently.
+	var pool sync.Pool
+	m.f = &NeighborhoodFilter{
+		In:     shape,
+		Out:    shape,
+		Radius: m.k.radius(),
+		Border: BorderMirror,
+		Fn: func(dst []byte, win *Window) {
+			s := getKernelScratch(&pool)
+			out := m.k.filterRow(s, win, channels, bpc)
+			center := win.Row(0)[win.Radius*channels*bpc:]
+			for i := range out {
+				v := float32(loadSample(center, i, bpc))
+				if i%channels < colors {
+					v = combine(v, out[i], maxv)
+				}
+				out[i] = v
+			}
+			for x := 0; x < win.Width; x++ {
+				storePixel(dst, x, out[x*channels:(x+1)*channels], bpc)
+			}
+			pool.Put(s)
+		},
+	}
+	return m, nil
+}
+
+func (m *blurMask) controls() []pix.Control {
+	return []pix.Control{
+		&pix.ControlOrdered[float32]{
+			Name:        "Amount",
+			Description: "Strength of the sharpening, 1 is 100%",
+			Value:       m.amount,
+			Min:         0,
+			Max:         5,
+			Step:        0.01,
+			OnChange: func(v float32) error {
+				m.amount = v
+				return nil
+			},
+		},
+		&pix.ControlOrdered[float32]{
+			Name:        "Radius",
+			Description: "Standard deviation (sigma) in pixels of the gaussian blur separating detail from base image",
+			Value:       m.radius,
+			Min:         0,
+			Max:         100,
+			Step:        0.1,
+			OnChange: func(v float32) error {
+				kernel := gaussianKernel(v)
+				m.k.x, m.k.y = kernel, kernel
+				m.radius = v
+				m.f.Radius = m.k.radius()
+				return nil
+			},
+		},
+	}
+}
+
+// NewUnsharpMask creates an unsharp mask sharpening filter. Each pixel is pushed away from its
+// gaussian blurred value by amount times their difference. Differences smaller than threshold,
+// in 8-bit levels 0 to 255, are left unsharpened to avoid amplifying noise in flat areas.
+// The blur is the one of [NewGaussianBlur] with radius as standard deviation.
+//
+// It supports the shapes of [NewGaussianBlur], ROI and in-place processing.
+func NewUnsharpMask(shape pix.Shape, amount, radius, threshold float32) (*NeighborhoodFilter, error) {
+	if threshold < 0 {
+		return nil, errors.New("negative sharpen threshold")
+	}
+	var m *blurMask
+	m, err := newBlurMask(shape, radius, amount, func(src, blurred, maxv float32) float32 {
+		diff := src - blurred
+		if max(diff, -diff) < threshold*maxv/255 {
+			return src
+		}
+		return src + m.amount*diff
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.f.Ctrls = append(m.controls(), &pix.ControlOrdered[float32]{
+		Name:        "Threshold",
+		Description: "Minimum difference in 8-bit levels between a pixel and its surroundings to be sharpened",
+		Value:       threshold,
+		Min:         0,
+		Max:         255,
+		Step:        1,
+		OnChange: func(v float32) error {
+			threshold = v
+			return nil
+		},
+	})
+	return m.f, nil
+}
+
+// NewHighPassSharpen creates a high-pass sharpening filter. The high-pass detail, the difference
+// between a pixel and its gaussian blurred value, is scaled by amount and overlay blended onto the image.
+// Unlike [NewUnsharpMask] the overlay blend boosts contrast of details more in midtones than in
+// highlights and shadows which are less prone to clipping.
+//
+// It supports the shapes of [NewGaussianBlur], ROI and in-place processing.
+func NewHighPassSharpen(shape pix.Shape, amount, radius float32) (*NeighborhoodFilter, error) {
+	var m *blurMask
+	m, err := newBlurMask(shape, radius, amount, func(src, blurred, maxv float32) float32 {
+		base := src / maxv
+		blend := 0.5 + m.amount*(src-blurred)/maxv
+		blend = max(0, min(blend, 1))
+		if base < 0.5 {
+			return 2 * base * blend * maxv
+		}
+		return (1 - 2*(1-base)*(1-blend)) * maxv
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.f.Ctrls = m.controls()
+	return m.f, nil
+}
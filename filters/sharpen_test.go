@@ -0,0 +1,94 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+func TestUnsharpMask(t *testing.T) {
+	const width, height = 12, 9
+	// Vertical step edge.
+	img := &testImage{dims: pix.Dims{Width: width, Height: height, Stride: width, Shape: pix.ShapeGrayscale8bit}, buf: make([]byte, width*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.buf[y*width+x] = 80
+			if x >= width/2 {
+				img.buf[y*width+x] = 160
+			}
+		}
+	}
+	f, err := NewUnsharpMask(pix.ShapeGrayscale8bit, 1, 1.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := processFilter(t, f, img, nil)
+	row := got[4*width : 5*width]
+	if row[width/2-1] >= 80 || row[width/2] <= 160 {
+		t.Errorf("edge not sharpened: %v", row)
+	} else if row[0] != 80 || row[width-1] != 160 {
+		t.Errorf("flat area modified: %v", row)
+	}
+
+	// A threshold above the edge contrast disables sharpening.
+	err = f.Controls()[2].ChangeValue(float32(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = processFilter(t, f, img, nil)
+	if !bytes.Equal(got, img.buf) {
+		t.Error("threshold did not prevent sharpening")
+	}
+}
+
+func TestSharpenInPlaceROI(t *testing.T) {
+	for _, shape := range kernelShapes {
+		unsharp, err := NewUnsharpMask(shape, 0.8, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		highPass, err := NewHighPassSharpen(shape, 1.5, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []*NeighborhoodFilter{unsharp, highPass} {
+			img := newRandomImage(newRand(), 15, 10, shape)
+			premultiply(img)
+			rect := image.Rect(3, 2, 12, 9)
+			want := processFilter(t, f, img, &rect)
+			_, err = f.Process(nil, img, &rect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bpp := shape.BitsPerPixel() / 8
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				off := y*img.dims.Stride + rect.Min.X*bpp
+				wantRow := want[(y-rect.Min.Y)*rect.Dx()*bpp:][:rect.Dx()*bpp]
+				if !bytes.Equal(img.buf[off:off+len(wantRow)], wantRow) {
+					t.Fatalf("shape %d: in-place row %d differs", shape, y)
+				}
+			}
+			if shape == pix.ShapeRGBA8888 {
+				for i := 0; i < len(want); i += 4 {
+					if want[i] > want[i+3] || want[i+1] > want[i+3] || want[i+2] > want[i+3] {
+						t.Fatal("invalid premultiplied output")
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestHighPassSharpenFlat(t *testing.T) {
+	img := &testImage{dims: pix.Dims{Width: 8, Height: 8, Stride: 24, Shape: pix.ShapeRGB888}, buf: bytes.Repeat([]byte{10, 128, 250}, 64)}
+	f, err := NewHighPassSharpen(pix.ShapeRGB888, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := processFilter(t, f, img, nil)
+	if d := maxDiff(got, img.buf); d > 1 {
+		t.Errorf("flat image changed by %d", d)
+	}
+}
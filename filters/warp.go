@@ -0,0 +1,422 @@
+package filters
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/soypat/geometry/ms2"
+	"github.com/soypat/geometry/ms3"
+	"github.com/soypat/pix"
+)
+
+// Sampling selects how [Warp] computes pixel values at positions between source pixel centers.
+type Sampling int
+
+const (
+	// SampleNearest takes the value of the nearest source pixel.
+	SampleNearest Sampling = iota
+	// SampleBilinear interpolates linearly between the 2x2 nearest source pixels.
+	SampleBilinear
+	// SampleBicubic interpolates the 4x4 nearest source pixels with the Catmull-Rom cubic.
+	SampleBicubic
+)
+
+func (s Sampling) String() string {
+	switch s {
+	case SampleNearest:
+		return "Nearest"
+	case SampleBilinear:
+		return "Bilinear"
+	case SampleBicubic:
+		return "Bicubic"
+	default:
+		return "Unknown"
+	}
+}
+
+// catmullRom is the cubic used by [SampleBicubic].
+var catmullRom = cubicKernel(0, 0.5)
+
+// warpBand is the number of output rows computed from each read of the source rows they map to.
+const warpBand = 32
+
+// Warp is a filter which maps the source image or ROI through an affine or perspective transform.
+// The transform maps source coordinates to output coordinates, where pixel (x,y) covers
+// the square from (x,y) to (x+1,y+1) and coordinates are relative to the ROI's top left corner.
+// Each output pixel center is mapped back to the source and sampled there.
+// Output pixels which map outside the source are set to the fill color, which is also blended into
+// the edges of the source when interpolating. Sampling and fill can be changed with the filter's controls.
+//
+// Output rows are computed in bands and only the source rows the band maps to are read,
+// so rotations and mild perspective warps of streamed images keep few source rows in memory.
+// Warp supports all byte-aligned shapes and does not support in-place processing.
+type Warp struct {
+	shape         pix.Shape
+	layout        floatLayout
+	inv           [9]float64 // Output to source transform in row-major order.
+	width, height int
+	sampling      Sampling
+	fill          []float32
+	ctrls         []pix.Control
+}
+
+var (
+	_ pix.DimsFilter   = (*Warp)(nil)
+	_ pix.RowProcessor = (*Warp)(nil)
+)
+
+// NewAffineWarp creates a filter mapping source point p to m*p+offset, which rotates, scales, shears and translates
+// the image. The output is width x height pixels, or the size of the source ROI if width or height are zero.
+//
+// Rotating the image by angle around its center c is achieved with m = [ms2.RotationMat2](angle) and
+// offset = c - m*c. Since the y axis points down positive angles rotate clockwise.
+func NewAffineWarp(shape pix.Shape, m ms2.Mat2, offset ms2.Vec, width, height int, sampling Sampling, fill color.RGBA64) (*Warp, error) {
+	w, err := newWarp(shape, width, height, sampling, fill)
+	if err != nil {
+		return nil, err
+	}
+	return w, w.SetAffine(m, offset)
+}
+
+// NewPerspectiveWarp creates a filter mapping source points through the homography h: the source point (x,y)
+// maps to (u/w, v/w) where (u,v,w) = h*(x,y,1). Use [Homography] to compute the homography mapping a quadrilateral
+// to another, i.e: the corners of a photographed document to the corners of the output.
+// The output is width x height pixels, or the size of the source ROI if width or height are zero.
+func NewPerspectiveWarp(shape pix.Shape, h ms3.Mat3, width, height int, sampling Sampling, fill color.RGBA64) (*Warp, error) {
+	w, err := newWarp(shape, width, height, sampling, fill)
+	if err != nil {
+		return nil, err
+	}
+	return w, w.SetPerspective(h)
+}
+
+func newWarp(shape pix.Shape, width, height int, sampling Sampling, fill color.RGBA64) (*Warp, error) {
+	layout, err := newFloatLayout(shape)
+	if err != nil {
+		return nil, err
+	} else if width < 0 || height < 0 {
+		return nil, errors.New("negative warp output size")
+	} else if sampling < SampleNearest || sampling > SampleBicubic {
+		return nil, errors.New("invalid warp sampling")
+	}
+	w := &Warp{shape: shape, layout: layout, width: width, height: height, sampling: sampling}
+	w.setFill(fill)
+	w.ctrls = []pix.Control{
+		&pix.ControlEnum[Sampling]{
+			Name:        "Sampling",
+			Description: "Interpolation of source pixels at mapped positions",
+			Value:       sampling,
+			ValidValues: []Sampling{SampleNearest, SampleBilinear, SampleBicubic},
+			OnChange: func(s Sampling) error {
+				w.sampling = s
+				return nil
+			},
+		},
+		&pix.ControlColor{
+			Name:        "Fill",
+			Description: "Color of output pixels which map outside the source",
+			Value:       fill,
+			OnChange: func(c color.RGBA64) error {
+				w.setFill(c)
+				return nil
+			},
+		},
+	}
+	return w, nil
+}
+
+// setFill converts fill to the sample range of the shape by encoding it.
+func (w *Warp) setFill(fill color.RGBA64) {
+	codec, _ := w.shape.Codec()
+	px := make([]byte, w.shape.BitsPerPixel()/8)
+	codec.Encode(px, 0, fill)
+	w.fill = make([]float32, w.layout.channels)
+	w.layout.load(w.fill, px)
+}
+
+// SetAffine sets the transform of the warp to the affine transform p -> m*p+offset. See [NewAffineWarp].
+// It fails if m is not invertible.
+func (w *Warp) SetAffine(m ms2.Mat2, offset ms2.Vec) error {
+	a := m.Array()
+	return w.setTransform([9]float64{
+		float64(a[0]), float64(a[1]), float64(offset.X),
+		float64(a[2]), float64(a[3]), float64(offset.Y),
+		0, 0, 1,
+	})
+}
+
+// SetPerspective sets the transform of the warp to the homography h. See [NewPerspectiveWarp].
+// It fails if h is not invertible.
+func (w *Warp) SetPerspective(h ms3.Mat3) error {
+	a := h.Array()
+	var m [9]float64
+	for i, v := range a {
+		m[i] = float64(v)
+	}
+	return w.setTransform(m)
+}
+
+func (w *Warp) setTransform(m [9]float64) error {
+	inv, ok := invert3(m)
+	if !ok {
+		return errors.New("warp transform is not invertible")
+	}
+	w.inv = inv
+	return nil
+}
+
+// ShapeIO implements [pix.Filter].
+func (w *Warp) ShapeIO() (output, input pix.Shape) {
+	return w.shape, w.shape
+}
+
+// Controls implements [pix.Filter].
+func (w *Warp) Controls() []pix.Control {
+	return w.ctrls
+}
+
+// OutputDims implements [pix.DimsFilter].
+func (w *Warp) OutputDims(src pix.Dims, roi *image.Rectangle) (pix.Dims, error) {
+	if src.Shape != w.shape {
+		return pix.Dims{}, errShapeMismatch
+	}
+	d := pix.Dims{Width: w.width, Height: w.height, Shape: w.shape}
+	if d.Width == 0 || d.Height == 0 {
+		d.Width, d.Height = src.Width, src.Height
+		if roi != nil {
+			d.Width, d.Height = roi.Dx(), roi.Dy()
+		}
+	}
+	d.Stride = d.SizeRow()
+	return d, d.Validate()
+}
+
+// Process implements [pix.Filter]. dst must not be nil and output rows are packed.
+func (w *Warp) Process(dst []byte, src pix.Image, roi *image.Rectangle) (pix.Dims, error) {
+	if dst == nil {
+		return pix.Dims{}, errors.New("warp does not support in-place processing")
+	}
+	outDims, err := pix.OutputDims(w, src.Dims(), roi)
+	if err != nil {
+		return pix.Dims{}, err
+	} else if int64(len(dst)) < outDims.Size() {
+		return pix.Dims{}, errors.New("destination buffer not large enough to store output")
+	}
+	for y0 := 0; y0 < outDims.Height; y0 += warpBand {
+		y1 := min(y0+warpBand, outDims.Height)
+		err = w.ProcessRows(dst[y0*outDims.Stride:], outDims.Stride, src, roi, y0, y1)
+		if err != nil {
+			return pix.Dims{}, err
+		}
+	}
+	return outDims, nil
+}
+
+// ProcessRows implements [pix.RowProcessor]. Only the source rows output rows y0 to y1 map to are read.
+func (w *Warp) ProcessRows(dst []byte, stride int, src pix.Image, roi *image.Rectangle, y0, y1 int) error {
+	srcDims := src.Dims()
+	outDims, err := pix.OutputDims(w, srcDims, roi)
+	if err != nil {
+		return err
+	} else if y0 < 0 || y1 > outDims.Height || y0 >= y1 {
+		return errors.New("invalid row range")
+	} else if stride < outDims.SizeRow() || len(dst) < (y1-y0-1)*stride+outDims.SizeRow() {
+		return errors.New("destination buffer not large enough to store output")
+	}
+	r := image.Rect(0, 0, srcDims.Width, srcDims.Height)
+	if roi != nil {
+		r = *roi
+	}
+	s := warpSource{
+		layout: w.layout,
+		bpp:    srcDims.Shape.BitsPerPixel() / 8,
+		width:  r.Dx(),
+		stride: srcDims.Stride,
+		fill:   w.fill,
+	}
+	s.xoff = r.Min.X * s.bpp
+	s.y0, s.y1 = w.footprint(outDims.Width, y0, y1, r.Dy())
+	if s.y0 < s.y1 {
+		off := int64(r.Min.Y+s.y0) * int64(srcDims.Stride)
+		size := (s.y1-s.y0-1)*srcDims.Stride + srcDims.SizeRow()
+		if buffered, ok := src.(pix.ImageBuffered); ok && buffered.Buffer() != nil {
+			s.rows = buffered.Buffer()[off : off+int64(size)]
+		} else {
+			s.rows = make([]byte, size)
+			if n, err := src.ReadAt(s.rows, off); n != size {
+				if err == nil {
+					err = errors.New("short read")
+				}
+				return err
+			}
+		}
+	}
+	ch := w.layout.channels
+	out := make([]float32, outDims.Width*ch)
+	inv := &w.inv
+	for y := y0; y < y1; y++ {
+		v := float64(y) + 0.5
+		for x := range outDims.Width {
+			u := float64(x) + 0.5
+			px := out[x*ch : (x+1)*ch]
+			den := inv[6]*u + inv[7]*v + inv[8]
+			if den <= 0 {
+				// Point maps behind the projection center.
+				copy(px, w.fill)
+				continue
+			}
+			// Source position relative to source pixel centers.
+			sx := (inv[0]*u+inv[1]*v+inv[2])/den - 0.5
+			sy := (inv[3]*u+inv[4]*v+inv[5])/den - 0.5
+			w.sample(px, &s, sx, sy)
+		}
+		w.layout.store(dst[(y-y0)*stride:], out)
+	}
+	return nil
+}
+
+// footprint returns the range of source rows sampled by output rows y0 to y1 clamped to the source height.
+func (w *Warp) footprint(width, y0, y1, srcHeight int) (sy0, sy1 int) {
+	inv := &w.inv
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, c := range [4][2]float64{{0, float64(y0)}, {float64(width), float64(y0)}, {0, float64(y1)}, {float64(width), float64(y1)}} {
+		den := inv[6]*c[0] + inv[7]*c[1] + inv[8]
+		if den <= 0 {
+			// Band crosses the horizon and maps to an unbounded region.
+			return 0, srcHeight
+		}
+		sy := (inv[3]*c[0] + inv[4]*c[1] + inv[5]) / den
+		minY, maxY = min(minY, sy), max(maxY, sy)
+	}
+	// Margin covers the bicubic taps and rounding.
+	sy0 = int(max(0, min(math.Floor(minY)-3, float64(srcHeight))))
+	sy1 = int(max(0, min(math.Ceil(maxY)+3, float64(srcHeight))))
+	return sy0, sy1
+}
+
+// sample computes the value of the source at position (sx,sy) in pixel index units.
+func (w *Warp) sample(px []float32, s *warpSource, sx, sy float64) {
+	switch w.sampling {
+	case SampleNearest:
+		copy(px, s.pixel(int(math.Floor(sx+0.5)), int(math.Floor(sy+0.5))))
+		return
+	case SampleBilinear:
+		x0, y0 := math.Floor(sx), math.Floor(sy)
+		fx, fy := float32(sx-x0), float32(sy-y0)
+		ix, iy := int(x0), int(y0)
+		clear(px)
+		for k, wt := range [4]float32{(1 - fx) * (1 - fy), fx * (1 - fy), (1 - fx) * fy, fx * fy} {
+			for c, v := range s.pixel(ix+k%2, iy+k/2) {
+				px[c] += wt * v
+			}
+		}
+		return
+	}
+	x0, y0 := math.Floor(sx), math.Floor(sy)
+	var wx, wy [4]float32
+	for i := range 4 {
+		wx[i] = float32(catmullRom(sx - x0 - float64(i-1)))
+		wy[i] = float32(catmullRom(sy - y0 - float64(i-1)))
+	}
+	clear(px)
+	for j := range 4 {
+		for i := range 4 {
+			wt := wx[i] * wy[j]
+			for c, v := range s.pixel(int(x0)+i-1, int(y0)+j-1) {
+				px[c] += wt * v
+			}
+		}
+	}
+}
+
+// warpSource provides random access to the pixels of a band of source rows as float32 samples.
+type warpSource struct {
+	layout floatLayout
+	rows   []byte // Source rows y0 to y1 of the ROI.
+	y0, y1 int
+	stride int
+	xoff   int // Byte offset of the ROI within rows.
+	bpp    int
+	width  int
+	fill   []float32
+	tmp    [4]float32
+}
+
+// pixel returns the samples of pixel (x,y) of the ROI or the fill color if outside it.
+// The returned slice is only valid until the next call.
+func (s *warpSource) pixel(x, y int) []float32 {
+	if x < 0 || y < s.y0 || x >= s.width || y >= s.y1 {
+		return s.fill
+	}
+	px := s.tmp[:s.layout.channels]
+	s.layout.load(px, s.rows[(y-s.y0)*s.stride+s.xoff+x*s.bpp:])
+	return px
+}
+
+// invert3 returns the inverse of the row-major 3x3 matrix m.
+func invert3(m [9]float64) (inv [9]float64, ok bool) {
+	det := m[0]*(m[4]*m[8]-m[5]*m[7]) - m[1]*(m[3]*m[8]-m[5]*m[6]) + m[2]*(m[3]*m[7]-m[4]*m[6])
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return inv, false
+	}
+	d := 1 / det
+	inv = [9]float64{
+		(m[4]*m[8] - m[5]*m[7]) * d, (m[2]*m[7] - m[1]*m[8]) * d, (m[1]*m[5] - m[2]*m[4]) * d,
+		(m[5]*m[6] - m[3]*m[8]) * d, (m[0]*m[8] - m[2]*m[6]) * d, (m[2]*m[3] - m[0]*m[5]) * d,
+		(m[3]*m[7] - m[4]*m[6]) * d, (m[1]*m[6] - m[0]*m[7]) * d, (m[0]*m[4] - m[1]*m[3]) * d,
+	}
+	return inv, true
+}
+
+// Homography returns the perspective transform, for use with [NewPerspectiveWarp], which maps
+// the four points of from to the corresponding points of to. It fails if three of the points of either
+// quadrilateral are collinear.
+func Homography(from, to [4]ms2.Vec) (ms3.Mat3, error) {
+	// Solve the 8 unknowns of h with h[8]=1 from x'(h6 x + h7 y + 1) = h0 x + h1 y + h2 and the equivalent for y'.
+	var a [8][9]float64
+	for i := range 4 {
+		x, y := float64(from[i].X), float64(from[i].Y)
+		u, v := float64(to[i].X), float64(to[i].Y)
+		a[2*i] = [9]float64{x, y, 1, 0, 0, 0, -x * u, -y * u, u}
+		a[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -x * v, -y * v, v}
+	}
+	// Gaussian elimination with partial pivoting.
+	for col := range 8 {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return ms3.Mat3{}, errors.New("degenerate homography points")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := range 8 {
+			if row == col {
+				continue
+			}
+			f := a[row][col] / a[col][col]
+			for k := col; k < 9; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+		}
+	}
+	h := [9]float64{8: 1}
+	for i := range 8 {
+		h[i] = a[i][8] / a[i][i]
+	}
+	// Collinear points of one quadrilateral but not the other yield a singular matrix.
+	det := h[0]*(h[4]*h[8]-h[5]*h[7]) - h[1]*(h[3]*h[8]-h[5]*h[6]) + h[2]*(h[3]*h[7]-h[4]*h[6])
+	norm := math.Hypot(math.Hypot(h[0], h[1]), h[2]) * math.Hypot(math.Hypot(h[3], h[4]), h[5]) * math.Hypot(math.Hypot(h[6], h[7]), h[8])
+	if math.Abs(det) < 1e-9*norm {
+		return ms3.Mat3{}, errors.New("degenerate homography points")
+	}
+	var h32 [9]float32
+	for i, v := range h {
+		h32[i] = float32(v)
+	}
+	return ms3.NewMat3(h32[:]), nil
+}
@@ -0,0 +1,205 @@
+package filters
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/soypat/geometry/ms2"
+	"github.com/soypat/geometry/ms3"
+	"github.com/soypat/pix"
+)
+
+var samplings = []Sampling{SampleNearest, SampleBilinear, SampleBicubic}
+
+// packRows returns the pixel rows of img within r without stride padding.
+func packRows(img *testImage, r image.Rectangle) []byte {
+	bpp := img.dims.Shape.BitsPerPixel() / 8
+	var packed []byte
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		packed = append(packed, img.buf[y*img.dims.Stride+r.Min.X*bpp:][:r.Dx()*bpp]...)
+	}
+	return packed
+}
+
+func TestWarpIdentity(t *testing.T) {
+	for _, shape := range byteAlignedShapes {
+		img := newRandomImage(newRand(), 11, 8, shape)
+		premultiply(img)
+		roi := image.Rect(1, 2, 10, 8)
+		want := packRows(img, roi)
+		for _, s := range samplings {
+			w, err := NewAffineWarp(shape, ms2.IdentityMat2(), ms2.Vec{}, 0, 0, s, color.RGBA64{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := processFilter(t, w, img, &roi)
+			if !bytes.Equal(got, want) {
+				t.Errorf("shape %d sampling %s: identity warp changed image", shape, s)
+			}
+		}
+	}
+}
+
+func TestWarpTranslateFill(t *testing.T) {
+	const width, height = 9, 7
+	img := newRandomImage(newRand(), width, height, pix.ShapeRGB888)
+	fill := color.RGBA64{R: 0xffff, B: 0x8080, A: 0xffff}
+	for _, s := range samplings {
+		w, err := NewAffineWarp(pix.ShapeRGB888, ms2.IdentityMat2(), ms2.Vec{X: 3, Y: -2}, width, height, s, fill)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := processFilter(t, w, img, nil)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				want := []byte{0xff, 0, 0x80}
+				if sx, sy := x-3, y+2; sx >= 0 && sy < height {
+					want = img.buf[sy*img.dims.Stride+3*sx:][:3]
+				}
+				if px := got[3*(y*width+x):][:3]; !bytes.Equal(px, want) {
+					t.Fatalf("sampling %s: pixel (%d,%d) got %v, want %v", s, x, y, px, want)
+				}
+			}
+		}
+		// Fill can be changed after construction through its control.
+		for _, ctrl := range w.Controls() {
+			if name, _ := ctrl.Describe(); name == "Fill" {
+				if err = ctrl.ChangeValue(color.RGBA{G: 0x40, A: 0xff}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		got = processFilter(t, w, img, nil)
+		if px := got[:3]; !bytes.Equal(px, []byte{0, 0x40, 0}) {
+			t.Errorf("sampling %s: fill after control change got %v, want [0 64 0]", s, px)
+		}
+	}
+}
+
+func TestWarpRotate90(t *testing.T) {
+	const n = 12
+	img := newRandomImage(newRand(), n, n, pix.ShapeGrayscale16BE)
+	c := ms2.Vec{X: n / 2, Y: n / 2}
+	m := ms2.RotationMat2(math.Pi / 2)
+	w, err := NewAffineWarp(pix.ShapeGrayscale16BE, m, ms2.Sub(c, ms2.MulMatVec(m, c)), 0, 0, SampleNearest, color.RGBA64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rot, err := NewOrient(pix.ShapeGrayscale16BE, OrientRotate90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := processFilter(t, w, img, nil)
+	want := processFilter(t, rot, img, nil)
+	if !bytes.Equal(got, want) {
+		t.Error("warp rotation by 90 degrees differs from orientation filter")
+	}
+}
+
+func TestHomography(t *testing.T) {
+	from := [4]ms2.Vec{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}}
+	to := [4]ms2.Vec{{X: 1, Y: 2}, {X: 8, Y: 1}, {X: 11, Y: 9}, {X: -1, Y: 12}}
+	h, err := Homography(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range from {
+		q := ms3.MulMatVec(h, ms3.Vec{X: p.X, Y: p.Y, Z: 1})
+		got := ms2.Vec{X: q.X / q.Z, Y: q.Y / q.Z}
+		if math.Abs(float64(got.X-to[i].X)) > 1e-4 || math.Abs(float64(got.Y-to[i].Y)) > 1e-4 {
+			t.Errorf("point %d mapped to %v, want %v", i, got, to[i])
+		}
+	}
+	from[2] = ms2.Vec{X: 5, Y: 5} // Collinear with the first and third points.
+	if _, err = Homography(from, to); err == nil {
+		t.Error("expected error for degenerate points")
+	}
+}
+
+func TestWarpPerspectiveStreaming(t *testing.T) {
+	for _, shape := range byteAlignedShapes {
+		img := newRandomImage(newRand(), 70, 90, shape)
+		premultiply(img)
+		roi := image.Rect(3, 5, 67, 88)
+		// Scaling as homography matches the affine warp.
+		scale := ms2.NewMat2([]float32{0.5, 0, 0, 0.75})
+		affine, err := NewAffineWarp(shape, scale, ms2.Vec{X: 2, Y: 1}, 40, 70, SampleBilinear, color.RGBA64{A: 0xffff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := ms3.NewMat3([]float32{0.5, 0, 2, 0, 0.75, 1, 0, 0, 1})
+		persp, err := NewPerspectiveWarp(shape, h, 40, 70, SampleBilinear, color.RGBA64{A: 0xffff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := processFilter(t, affine, img, &roi)
+		got := processFilter(t, persp, readerImage{img}, &roi)
+		if d := maxDiff(got, want); d > 1 {
+			t.Errorf("shape %d: perspective scale differs from affine scale by %d", shape, d)
+		}
+
+		// Keystone correction of a trapezoid spanning the ROI.
+		corners := [4]ms2.Vec{{X: 10, Y: 5}, {X: 55, Y: 0}, {X: 64, Y: 83}, {X: 0, Y: 70}}
+		h, err = Homography(corners, [4]ms2.Vec{{X: 0, Y: 0}, {X: 50, Y: 0}, {X: 50, Y: 60}, {X: 0, Y: 60}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = persp.SetPerspective(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range samplings {
+			persp.Controls()[0].ChangeValue(s)
+			want := processFilter(t, persp, img, &roi)
+			dims, err := pix.OutputDims(persp, img.Dims(), &roi)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lazy, err := pix.NewLazyImage(persp, readerImage{img}, &roi)
+			if err != nil {
+				t.Fatal(err)
+			} else if lazy.Dims() != dims {
+				t.Fatalf("lazy dims %+v, want %+v", lazy.Dims(), dims)
+			}
+			got, err := io.ReadAll(io.NewSectionReader(lazy, 0, dims.Size()))
+			if err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(got, want) {
+				t.Errorf("shape %d sampling %s: lazy warp differs", shape, s)
+			}
+		}
+	}
+}
+
+func TestWarpNotInvertible(t *testing.T) {
+	_, err := NewAffineWarp(pix.ShapeRGB888, ms2.NewMat2([]float32{1, 2, 2, 4}), ms2.Vec{}, 0, 0, SampleNearest, color.RGBA64{})
+	if err == nil {
+		t.Error("expected error for singular matrix")
+	}
+}
+
+func BenchmarkWarpRotate(b *testing.B) {
+	img := newRandomImage(newRand(), 1280, 720, pix.ShapeRGB888)
+	c := ms2.Vec{X: 640, Y: 360}
+	m := ms2.RotationMat2(0.1)
+	for _, s := range samplings {
+		w, err := NewAffineWarp(pix.ShapeRGB888, m, ms2.Sub(c, ms2.MulMatVec(m, c)), 0, 0, s, color.RGBA64{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		dst := make([]byte, len(img.buf))
+		b.Run(s.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(img.buf)))
+			for i := 0; i < b.N; i++ {
+				_, err := w.Process(dst, img, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
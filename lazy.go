@@ -0,0 +1,129 @@
+package pix
+
+import (
+	"errors"
+	"image"
+	"io"
+	"sync"
+)
+
+// RowProcessor is implemented by filters that can compute any band of output rows on demand
+// without processing the rows that precede it.
+type RowProcessor interface {
+	Filter
+	// ProcessRows writes output rows y0 up to but not including y1 of the result
+	// [Filter.Process] would produce for the same src and roi. Output row y0 is written
+	// at the start of dst and consecutive rows are separated by stride bytes.
+	ProcessRows(dst []byte, stride int, src Image, roi *image.Rectangle, y0, y1 int) error
+}
+
+// LazyImage is an [Image] whose pixels are the output of a filter applied to a source image.
+// Rows are computed on demand when read with ReadAt so no full frame is ever allocated
+// if the filter implements [RowProcessor]. LazyImages may be chained to pull rows through a filter graph.
+type LazyImage struct {
+	f    Filter
+	rp   RowProcessor // Non-nil if f implements RowProcessor.
+	src  Image
+	roi  *image.Rectangle
+	dims Dims
+
+	mu sync.Mutex
+	// Last band of computed rows [y0,y1) reused by consecutive reads within the same rows.
+	y0, y1 int
+	band   []byte
+}
+
+var _ Image = (*LazyImage)(nil)
+
+// NewLazyImage returns an image of the output of f applied to src over roi, which may be nil.
+// The output dimensions are those returned by [OutputDims]. Rows are packed,
+// so Stride equals [Dims.SizeRow]. Filters which do not implement [RowProcessor] are supported by processing
+// the complete output on the first read and keeping it in memory.
+func NewLazyImage(f Filter, src Image, roi *image.Rectangle) (*LazyImage, error) {
+	srcDims := src.Dims()
+	if err := srcDims.Validate(); err != nil {
+		return nil, err
+	}
+	out, in := f.ShapeIO()
+	if in != srcDims.Shape {
+		return nil, errors.New("src shape does not match filter input shape")
+	}
+	dims, err := OutputDims(f, srcDims, roi)
+	if err != nil {
+		return nil, err
+	} else if dims.Shape != out {
+		return nil, errors.New("filter output dimensions do not match its output shape")
+	}
+	if roi != nil {
+		r := *roi
+		roi = &r
+	}
+	rp, _ := f.(RowProcessor)
+	return &LazyImage{f: f, rp: rp, src: src, roi: roi, dims: dims}, nil
+}
+
+// Dims implements [Image].
+func (li *LazyImage) Dims() Dims { return li.dims }
+
+// ReadAt implements [io.ReaderAt] computing the output rows that contain the requested bytes.
+// It is safe for concurrent use.
+func (li *LazyImage) ReadAt(p []byte, off int64) (int, error) {
+	size := li.dims.Size()
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	} else if off >= size {
+		return 0, io.EOF
+	} else if len(p) == 0 {
+		return 0, nil
+	}
+	var err error
+	if int64(len(p)) > size-off {
+		p = p[:size-off]
+		err = io.EOF
+	}
+	stride := int64(li.dims.Stride)
+	y0 := int(off / stride)
+	y1 := int((off+int64(len(p))-1)/stride) + 1
+
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	if li.band == nil || y0 < li.y0 || y1 > li.y1 {
+		if perr := li.compute(y0, y1); perr != nil {
+			return 0, perr
+		}
+	}
+	n := copy(p, li.band[off-int64(li.y0)*stride:])
+	return n, err
+}
+
+func (li *LazyImage) compute(y0, y1 int) error {
+	if li.rp == nil {
+		// Filter can't compute bands, process the whole image once.
+		y0, y1 = 0, li.dims.Height
+	}
+	d := li.dims
+	d.Height = y1 - y0
+	size := int(d.Size())
+	if cap(li.band) < size {
+		li.band = make([]byte, size)
+	}
+	li.band = li.band[:size]
+	if li.rp != nil {
+		err := li.rp.ProcessRows(li.band, d.Stride, li.src, li.roi, y0, y1)
+		if err != nil {
+			li.band = nil
+			return err
+		}
+	} else {
+		outDims, err := li.f.Process(li.band, li.src, li.roi)
+		if err != nil {
+			li.band = nil
+			return err
+		} else if outDims != li.dims {
+			li.band = nil
+			return errors.New("filter output does not match lazy image dimensions")
+		}
+	}
+	li.y0, li.y1 = y0, y1
+	return nil
+}
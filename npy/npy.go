@@ -0,0 +1,224 @@
+// Package npy reads and writes NumPy .npy files for exchanging images and tensors with Python.
+//
+// Images are written row by row to an [io.Writer] and read through an [io.ReaderAt]
+// so neither direction needs the whole array in memory.
+package npy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const magic = "\x93NUMPY"
+
+// growthAxisDigits is the number of digits numpy reserves in headers for the growth axis of the shape.
+const growthAxisDigits = 21
+
+// Header describes the array stored in a .npy file.
+type Header struct {
+	// Descr is the NumPy dtype descriptor, i.e: "|u1" for uint8, "<u2" for little endian uint16 and "<f4" for float32.
+	Descr string
+	// FortranOrder is true if the array is stored in column-major order. Only row-major arrays are supported.
+	FortranOrder bool
+	// Shape is the size of each dimension of the array, i.e: {height, width, channels} for color images.
+	Shape []int
+}
+
+// Len returns the number of elements of the array.
+func (h Header) Len() int {
+	n := 1
+	for _, d := range h.Shape {
+		n *= d
+	}
+	return n
+}
+
+// WriteHeader writes the magic string, version and header of a .npy file to w.
+// The array data must be written right after in row-major order.
+func WriteHeader(w io.Writer, h Header) error {
+	for _, d := range h.Shape {
+		if d < 0 {
+			return errors.New("negative array dimension")
+		}
+	}
+	var dict strings.Builder
+	fmt.Fprintf(&dict, "{'descr': '%s', 'fortran_order': %s, 'shape': (", h.Descr, pyBool(h.FortranOrder))
+	for i, d := range h.Shape {
+		if i > 0 {
+			dict.WriteString(", ")
+		}
+		dict.WriteString(strconv.Itoa(d))
+	}
+	if len(h.Shape) == 1 {
+		dict.WriteByte(',') // One element tuples need a trailing comma in Python.
+	}
+	dict.WriteString("), }")
+	// Like numpy.save, reserve room for the growth axis to reach 21 digits so arrays
+	// can be appended to in place without moving the data.
+	if len(h.Shape) > 0 {
+		axis := h.Shape[0]
+		if h.FortranOrder {
+			axis = h.Shape[len(h.Shape)-1]
+		}
+		dict.WriteString(strings.Repeat(" ", max(0, growthAxisDigits-len(strconv.Itoa(axis)))))
+	}
+	// Version 1.0 stores the header length in 2 bytes, version 2.0 in 4 bytes.
+	// The header is padded with at least one space and a newline so data starts aligned to 64 bytes.
+	padded := func(prefix int) int {
+		n := prefix + dict.Len() + 1
+		return n + 64 - n%64
+	}
+	prefix, version := 10, byte(1)
+	if padded(prefix)-prefix > 0xffff {
+		prefix, version = 12, 2
+	}
+	total := padded(prefix)
+	buf := make([]byte, 0, total)
+	buf = append(buf, magic...)
+	buf = append(buf, version, 0)
+	hlen := total - prefix
+	if version == 1 {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(hlen))
+	} else {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(hlen))
+	}
+	buf = append(buf, dict.String()...)
+	for len(buf) < total-1 {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, '\n')
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadHeader reads the header of a .npy file from r and returns it along with
+// the offset from the start of the file at which array data begins.
+func ReadHeader(r io.Reader) (h Header, dataOffset int64, err error) {
+	var pre [12]byte
+	if _, err = io.ReadFull(r, pre[:10]); err != nil {
+		return Header{}, 0, err
+	} else if string(pre[:6]) != magic {
+		return Header{}, 0, errors.New("not a .npy file")
+	}
+	var hlen int
+	switch pre[6] {
+	case 1:
+		hlen = int(binary.LittleEndian.Uint16(pre[8:10]))
+		dataOffset = 10
+	case 2, 3:
+		if _, err = io.ReadFull(r, pre[10:12]); err != nil {
+			return Header{}, 0, err
+		}
+		hlen = int(binary.LittleEndian.Uint32(pre[8:12]))
+		dataOffset = 12
+	default:
+		return Header{}, 0, fmt.Errorf("unsupported .npy version %d.%d", pre[6], pre[7])
+	}
+	if hlen > 1<<20 {
+		return Header{}, 0, errors.New(".npy header too large")
+	}
+	dict := make([]byte, hlen)
+	if _, err = io.ReadFull(r, dict); err != nil {
+		return Header{}, 0, err
+	}
+	h, err = parseHeader(string(dict))
+	if err != nil {
+		return Header{}, 0, err
+	}
+	return h, dataOffset + int64(hlen), nil
+}
+
+// parseHeader parses the Python dict literal of a .npy header.
+func parseHeader(s string) (h Header, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return Header{}, errors.New("malformed .npy header")
+	}
+	s = s[1 : len(s)-1]
+	var seen int
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		var key string
+		key, s, err = parseString(s)
+		if err != nil {
+			return Header{}, err
+		}
+		s = strings.TrimSpace(s)
+		if !strings.HasPrefix(s, ":") {
+			return Header{}, errors.New("malformed .npy header")
+		}
+		s = strings.TrimSpace(s[1:])
+		switch key {
+		case "descr":
+			h.Descr, s, err = parseString(s)
+		case "fortran_order":
+			switch {
+			case strings.HasPrefix(s, "True"):
+				h.FortranOrder, s = true, s[4:]
+			case strings.HasPrefix(s, "False"):
+				s = s[5:]
+			default:
+				err = errors.New("malformed .npy fortran_order")
+			}
+		case "shape":
+			h.Shape, s, err = parseTuple(s)
+		default:
+			return Header{}, fmt.Errorf("unknown .npy header key %q", key)
+		}
+		if err != nil {
+			return Header{}, err
+		}
+		seen++
+	}
+	if seen != 3 {
+		return Header{}, errors.New("incomplete .npy header")
+	}
+	return h, nil
+}
+
+// parseString parses a quoted Python string at the start of s and returns it and the remainder of s.
+func parseString(s string) (str, rest string, err error) {
+	if s == "" || (s[0] != '\'' && s[0] != '"') {
+		return "", s, errors.New("expected string in .npy header")
+	}
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", s, errors.New("unterminated string in .npy header")
+	}
+	return s[1 : end+1], s[end+2:], nil
+}
+
+// parseTuple parses a Python tuple of integers at the start of s and returns it and the remainder of s.
+func parseTuple(s string) (tuple []int, rest string, err error) {
+	end := strings.IndexByte(s, ')')
+	if !strings.HasPrefix(s, "(") || end < 0 {
+		return nil, s, errors.New("malformed .npy shape")
+	}
+	tuple = []int{} // Scalars have an empty, non-nil shape.
+	for _, field := range strings.Split(s[1:end], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		d, err := strconv.Atoi(strings.TrimSuffix(field, "L"))
+		if err != nil || d < 0 {
+			return nil, s, errors.New("invalid .npy shape dimension")
+		}
+		tuple = append(tuple, d)
+	}
+	return tuple, s[end+1:], nil
+}
+
+func pyBool(b bool) string {
+	if b {
+		return "True"
+	}
+	return "False"
+}
@@ -0,0 +1,268 @@
+package npy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/soypat/pix"
+	"github.com/soypat/pix/tensor"
+)
+
+func newRandomImage(rng *rand.Rand, width, height int, shape pix.Shape) *pix.MemImage {
+	d := pix.Dims{Width: width, Height: height, Shape: shape}
+	d.Stride = d.SizeRow() + 3
+	buf := make([]byte, d.Size())
+	rng.Read(buf)
+	img, err := pix.NewMemImage(buf, d)
+	if err != nil {
+		panic(err)
+	}
+	return img
+}
+
+func TestImageRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	shapes := []pix.Shape{pix.ShapeGrayscale8bit, pix.ShapeRGB888, pix.ShapeNRGBA8888, pix.ShapeGrayscale16BE}
+	for _, shape := range shapes {
+		img := newRandomImage(rng, 11, 7, shape)
+		roi := image.Rect(2, 1, 10, 7)
+		var buf bytes.Buffer
+		if err := WriteImage(&buf, img, &roi); err != nil {
+			t.Fatal(err)
+		}
+		hdr, off, err := ReadHeader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		} else if off%64 != 0 {
+			t.Errorf("shape %d: data offset %d not aligned to 64 bytes", shape, off)
+		} else if hdr.Shape[0] != 6 || hdr.Shape[1] != 8 {
+			t.Errorf("shape %d: got array shape %v, want 6x8", shape, hdr.Shape)
+		}
+		got, err := NewImage(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := got.Dims()
+		if d.Shape != shape || d.Width != 8 || d.Height != 6 {
+			t.Fatalf("shape %d: read dims %+v", shape, d)
+		}
+		bpp := shape.BitsPerPixel() / 8
+		row := make([]byte, d.SizeRow())
+		for y := range d.Height {
+			gotRow, err := pix.ImageRow(row, got, y)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := img.Buffer()[(y+roi.Min.Y)*img.Dims().Stride:][roi.Min.X*bpp : roi.Max.X*bpp]
+			if !bytes.Equal(gotRow, want) {
+				t.Fatalf("shape %d: row %d differs", shape, y)
+			}
+		}
+		if got.Buffer() != nil {
+			t.Error("expected nil buffer before Load")
+		} else if err = got.Load(); err != nil {
+			t.Fatal(err)
+		} else if int64(len(got.Buffer())) != d.Size() {
+			t.Errorf("loaded buffer length %d, want %d", len(got.Buffer()), d.Size())
+		}
+		if _, err = got.ReadAt(row, -1); err == nil {
+			t.Error("expected error for negative offset")
+		}
+	}
+}
+
+func TestWriteImageConvert(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		shape pix.Shape
+		want  pix.Shape
+	}{
+		{pix.ShapeRGBA8888, pix.ShapeNRGBA8888},
+		{pix.ShapeRGB565BE, pix.ShapeRGB888},
+		{pix.ShapeRGB444BE, pix.ShapeRGB888},
+		{pix.ShapeMonochrome, pix.ShapeGrayscale8bit},
+	}
+	for _, tt := range tests {
+		img := newRandomImage(rng, 9, 4, tt.shape)
+		var buf bytes.Buffer
+		if err := WriteImage(&buf, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewImage(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		} else if got.Dims().Shape != tt.want {
+			t.Fatalf("shape %d: read as shape %d, want %d", tt.shape, got.Dims().Shape, tt.want)
+		}
+		codec, _ := tt.want.Codec()
+		for y := range 4 {
+			for x := range 9 {
+				// Compare through the codec of the stored shape which quantizes like the writer.
+				c, _ := pix.GetPixel(img, x, y)
+				px := make([]byte, tt.want.BitsPerPixel()/8)
+				codec.Encode(px, 0, c)
+				want := codec.Decode(px, 0)
+				if g, _ := pix.GetPixel(got, x, y); g != want {
+					t.Fatalf("shape %d pixel (%d,%d): got %v, want %v", tt.shape, x, y, g, want)
+				}
+			}
+		}
+	}
+}
+
+// numpyFixtures are files written by numpy.save on arrays
+//
+//	np.array([[1, 2, 3], [256, 1000, 65535]], dtype='<u2')
+//	np.arange(12, dtype=np.uint8).reshape(2, 2, 3)
+//
+// and the big endian samples their image is expected to read as.
+var numpyFixtures = []struct {
+	file   string
+	header Header
+	shape  pix.Shape
+	pixels []byte
+}{
+	{
+		file: "\x93NUMPY\x01\x00v\x00{'descr': '<u2', 'fortran_order': False, 'shape': (2, 3), }                                                          \n" +
+			"\x01\x00\x02\x00\x03\x00\x00\x01\xe8\x03\xff\xff",
+		header: Header{Descr: "<u2", Shape: []int{2, 3}},
+		shape:  pix.ShapeGrayscale16BE,
+		pixels: []byte{0, 1, 0, 2, 0, 3, 1, 0, 0x03, 0xe8, 0xff, 0xff},
+	},
+	{
+		file: "\x93NUMPY\x01\x00v\x00{'descr': '|u1', 'fortran_order': False, 'shape': (2, 2, 3), }                                                       \n" +
+			"\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b",
+		header: Header{Descr: "|u1", Shape: []int{2, 2, 3}},
+		shape:  pix.ShapeRGB888,
+		pixels: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+}
+
+func TestNumpyFixtures(t *testing.T) {
+	for _, fx := range numpyFixtures {
+		var buf bytes.Buffer
+		if err := WriteHeader(&buf, fx.header); err != nil {
+			t.Fatal(err)
+		}
+		wantHeader := fx.file[:len(fx.file)-len(fx.pixels)]
+		if buf.String() != wantHeader {
+			t.Errorf("%s: WriteHeader got\n%q\nwant\n%q", fx.header.Descr, buf.String(), wantHeader)
+		}
+		img, err := NewImage(strings.NewReader(fx.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := img.Dims()
+		if d.Shape != fx.shape || d.Height != fx.header.Shape[0] || d.Width != fx.header.Shape[1] {
+			t.Fatalf("%s: got dims %+v", fx.header.Descr, d)
+		}
+		got, err := io.ReadAll(io.NewSectionReader(img, 0, d.Size()))
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, fx.pixels) {
+			t.Errorf("%s: got pixels %x, want %x", fx.header.Descr, got, fx.pixels)
+		}
+	}
+}
+
+func TestReadLittleEndian(t *testing.T) {
+	// Header as written by numpy.save for a little endian uint16 array.
+	dict := "{'descr': '<u2', 'fortran_order': False, 'shape': (2, 3), }"
+	dict += strings.Repeat(" ", 128-10-len(dict)-1) + "\n"
+	file := append([]byte(magic+"\x01\x00"), byte(len(dict)), 0)
+	file = append(file, dict...)
+	samples := []uint16{0x0102, 0x0304, 0x0506, 0x0708, 0x090a, 0x0b0c}
+	for _, v := range samples {
+		file = binary.LittleEndian.AppendUint16(file, v)
+	}
+	img, err := NewImage(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	} else if d := img.Dims(); d.Shape != pix.ShapeGrayscale16BE || d.Width != 3 || d.Height != 2 {
+		t.Fatalf("got dims %+v", d)
+	}
+	var want []byte
+	for _, v := range samples {
+		want = binary.BigEndian.AppendUint16(want, v)
+	}
+	got, err := io.ReadAll(io.NewSectionReader(img, 0, img.Dims().Size()))
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+	// Reads starting within a sample are swapped consistently.
+	p := make([]byte, 4)
+	n, err := img.ReadAt(p, 3)
+	if err != nil || n != 4 || !bytes.Equal(p, want[3:7]) {
+		t.Errorf("unaligned read got %x (%d, %v), want %x", p[:n], n, err, want[3:7])
+	}
+	n, err = img.ReadAt(p, 9)
+	if err != io.EOF || n != 3 || !bytes.Equal(p[:n], want[9:]) {
+		t.Errorf("read past end got %x (%d, %v), want %x and EOF", p[:n], n, err, want[9:])
+	}
+}
+
+func TestFloat32RoundTrip(t *testing.T) {
+	img := newRandomImage(rand.New(rand.NewSource(1)), 5, 3, pix.ShapeRGB888)
+	opts := tensor.Options{Layout: tensor.LayoutNCHW}
+	data := make([]float32, opts.Len(5, 3))
+	if err := tensor.ExportFloat32(data, img, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	shape := []int{1, 3, 3, 5}
+	var buf bytes.Buffer
+	if err := WriteFloat32(&buf, shape, data); err != nil {
+		t.Fatal(err)
+	}
+	hdr, got, err := ReadFloat32(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !slices.Equal(hdr.Shape, shape) || hdr.Descr != "<f4" {
+		t.Fatalf("got header %+v", hdr)
+	} else if !slices.Equal(got, data) {
+		t.Fatal("float32 data differs")
+	}
+	if err = WriteFloat32(&buf, []int{4, 4}, data); err == nil {
+		t.Error("expected error for shape not matching data")
+	}
+	if err = WriteFloat32(&buf, []int{15, 3}, data); err != nil {
+		t.Fatal(err)
+	} else if _, err = NewImage(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("expected error reading float32 array as image")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	for _, shape := range [][]int{{}, {7}, {2, 3}, {70000, 1, 2, 3}} {
+		var buf bytes.Buffer
+		want := Header{Descr: ">u2", FortranOrder: len(shape) == 1, Shape: shape}
+		if err := WriteHeader(&buf, want); err != nil {
+			t.Fatal(err)
+		}
+		got, off, err := ReadHeader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if off%64 != 0 || buf.Len() != 0 {
+			t.Errorf("shape %v: data offset %d with %d header bytes left", shape, off, buf.Len())
+		} else if got.Descr != want.Descr || got.FortranOrder != want.FortranOrder || !slices.Equal(got.Shape, want.Shape) {
+			t.Errorf("got header %+v, want %+v", got, want)
+		}
+	}
+	for _, dict := range []string{
+		"{'descr': '<f4', 'shape': (2,), }",
+		"{'descr': '<f4', 'fortran_order': Maybe, 'shape': (2,), }",
+		"{'descr': '<f4', 'fortran_order': False, 'shape': (-2,), }",
+		"'descr': '<f4'",
+	} {
+		if _, err := parseHeader(dict); err == nil {
+			t.Errorf("expected error parsing %q", dict)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package npy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/soypat/pix"
+)
+
+// Image is a .npy array read as a pix image through an [io.ReaderAt]. Pixel data is read
+// from the underlying reader on demand starting at the header offset, so the file is not loaded
+// into memory unless [Image.Load] is called.
+//
+// Supported arrays are row-major uint8 height x width or height x width x 1 arrays as Grayscale8bit,
+// uint8 height x width x 3 as RGB888, uint8 height x width x 4 as NRGBA8888 and uint16 of either
+// byte order with height x width or height x width x 1 as Grayscale16BE.
+// Little endian uint16 data is byte swapped as it is read.
+type Image struct {
+	hdr  Header
+	dims pix.Dims
+	data *io.SectionReader
+	swap bool // Swap bytes of 16 bit samples to big endian.
+	buf  []byte
+}
+
+var _ pix.ImageBuffered = (*Image)(nil)
+
+// NewImage reads the .npy header at the start of r and returns the array as an image.
+func NewImage(r io.ReaderAt) (*Image, error) {
+	hdr, off, err := ReadHeader(io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	} else if hdr.FortranOrder {
+		return nil, errors.New("column-major .npy arrays not supported")
+	}
+	img := &Image{hdr: hdr}
+	channels := 1
+	switch len(hdr.Shape) {
+	case 2:
+	case 3:
+		channels = hdr.Shape[2]
+	default:
+		return nil, fmt.Errorf("%d dimensional .npy array is not an image", len(hdr.Shape))
+	}
+	var shape pix.Shape
+	switch hdr.Descr {
+	case "|u1", "<u1", ">u1":
+		switch channels {
+		case 1:
+			shape = pix.ShapeGrayscale8bit
+		case 3:
+			shape = pix.ShapeRGB888
+		case 4:
+			shape = pix.ShapeNRGBA8888
+		}
+	case "<u2", ">u2":
+		if channels == 1 {
+			shape = pix.ShapeGrayscale16BE
+			img.swap = hdr.Descr[0] == '<'
+		}
+	default:
+		return nil, fmt.Errorf("unsupported .npy image dtype %q", hdr.Descr)
+	}
+	if shape == 0 {
+		return nil, fmt.Errorf("unsupported .npy image with %d channels of dtype %q", channels, hdr.Descr)
+	}
+	img.dims = pix.Dims{Width: hdr.Shape[1], Height: hdr.Shape[0], Shape: shape}
+	img.dims.Stride = img.dims.SizeRow()
+	if err = img.dims.Validate(); err != nil {
+		return nil, err
+	}
+	img.data = io.NewSectionReader(r, off, img.dims.Size())
+	return img, nil
+}
+
+// Header returns the .npy header of the image.
+func (img *Image) Header() Header { return img.hdr }
+
+// Dims implements [pix.Image].
+func (img *Image) Dims() pix.Dims { return img.dims }
+
+// Buffer implements [pix.ImageBuffered]. It returns nil until [Image.Load] is called.
+func (img *Image) Buffer() []byte { return img.buf }
+
+// Load reads all pixel data into memory so it is returned by [Image.Buffer].
+func (img *Image) Load() error {
+	if img.buf != nil {
+		return nil
+	}
+	buf := make([]byte, img.dims.Size())
+	if _, err := img.ReadAt(buf, 0); err != nil {
+		return err
+	}
+	img.buf = buf
+	return nil
+}
+
+// ReadAt implements [io.ReaderAt] over the pixel data of the image.
+func (img *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	} else if img.buf != nil {
+		if off >= int64(len(img.buf)) {
+			return 0, io.EOF
+		}
+		n := copy(p, img.buf[off:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	} else if !img.swap {
+		return img.data.ReadAt(p, off)
+	}
+	// Read whole 16 bit samples so they can be swapped regardless of the alignment of off.
+	start := off &^ 1
+	end := min(off+int64(len(p))+1, img.data.Size()) &^ 1
+	if start >= end {
+		return 0, io.EOF
+	}
+	tmp := make([]byte, end-start)
+	n, err := img.data.ReadAt(tmp, start)
+	n &^= 1
+	for i := 0; i < n; i += 2 {
+		tmp[i], tmp[i+1] = tmp[i+1], tmp[i]
+	}
+	got := 0
+	if skip := int(off - start); n > skip {
+		got = copy(p, tmp[skip:n])
+	}
+	if got < len(p) && err == nil {
+		err = io.EOF
+	}
+	return got, err
+}
+
+// ReadFloat32 reads a float32 .npy array of either byte order from r, i.e: a tensor written by [WriteFloat32].
+func ReadFloat32(r io.Reader) (Header, []float32, error) {
+	hdr, _, err := ReadHeader(r)
+	if err != nil {
+		return Header{}, nil, err
+	} else if hdr.FortranOrder {
+		return Header{}, nil, errors.New("column-major .npy arrays not supported")
+	}
+	var order binary.ByteOrder
+	switch hdr.Descr {
+	case "<f4":
+		order = binary.LittleEndian
+	case ">f4":
+		order = binary.BigEndian
+	default:
+		return Header{}, nil, fmt.Errorf("not a float32 .npy array, got dtype %q", hdr.Descr)
+	}
+	data := make([]float32, hdr.Len())
+	buf := make([]byte, 4*min(1024, len(data)))
+	for i := 0; i < len(data); {
+		n := min(len(buf)/4, len(data)-i)
+		if _, err = io.ReadFull(r, buf[:4*n]); err != nil {
+			return Header{}, nil, err
+		}
+		for k := range n {
+			data[i+k] = math.Float32frombits(order.Uint32(buf[4*k:]))
+		}
+		i += n
+	}
+	return hdr, data, nil
+}
@@ -0,0 +1,127 @@
+package npy
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/soypat/pix"
+)
+
+// arrayShape returns the shape images of shape sh are stored as. Shapes without a
+// NumPy counterpart are converted: RGBA8888 to non-premultiplied NRGBA8888 as expected by
+// Python imaging libraries, packed color shapes to RGB888 and sub-byte grayscale shapes to Grayscale8bit.
+func arrayShape(sh pix.Shape) pix.Shape {
+	switch sh {
+	case pix.ShapeRGB888, pix.ShapeNRGBA8888, pix.ShapeGrayscale8bit, pix.ShapeGrayscale16BE:
+		return sh
+	case pix.ShapeRGBA8888:
+		return pix.ShapeNRGBA8888
+	case pix.ShapeGrayscale2bit, pix.ShapeMonochrome:
+		return pix.ShapeGrayscale8bit
+	default:
+		return pix.ShapeRGB888
+	}
+}
+
+// imageHeader returns the header of an image of dims d with a shape returned by [arrayShape].
+// Grayscale images are stored as height x width arrays and color images as height x width x channels.
+func imageHeader(d pix.Dims) Header {
+	h := Header{Descr: "|u1", Shape: []int{d.Height, d.Width}}
+	switch d.Shape {
+	case pix.ShapeGrayscale16BE:
+		h.Descr = ">u2"
+	case pix.ShapeRGB888:
+		h.Shape = append(h.Shape, 3)
+	case pix.ShapeNRGBA8888:
+		h.Shape = append(h.Shape, 4)
+	}
+	return h
+}
+
+// WriteImage writes the pixels of img within roi, or all of img if roi is nil, to w as a .npy array.
+// Grayscale8bit is written as a uint8 height x width array, Grayscale16BE as a big endian uint16 height x width array,
+// RGB888 and NRGBA8888 as uint8 height x width x 3 and 4 arrays. Other shapes are converted through their codec:
+// RGBA8888 to non-premultiplied RGBA, RGB565BE, RGB555 and RGB444BE to RGB and sub-byte grayscale to 8 bit grayscale.
+//
+// Rows are read with [pix.ImageRow] and written one at a time so img may be larger than memory.
+func WriteImage(w io.Writer, img pix.Image, roi *image.Rectangle) error {
+	d := img.Dims()
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	r := image.Rect(0, 0, d.Width, d.Height)
+	if roi != nil {
+		if !roi.In(r) || roi.Empty() {
+			return errors.New("ROI exceeds image bounds or is empty")
+		}
+		r = *roi
+	}
+	out := pix.Dims{Width: r.Dx(), Height: r.Dy(), Shape: arrayShape(d.Shape)}
+	out.Stride = out.SizeRow()
+	if err := WriteHeader(w, imageHeader(out)); err != nil {
+		return err
+	}
+	rowBuf := make([]byte, d.SizeRow())
+	if out.Shape == d.Shape {
+		bpp := d.Shape.BitsPerPixel() / 8
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row, err := pix.ImageRow(rowBuf, img, y)
+			if err != nil {
+				return err
+			}
+			if _, err = w.Write(row[r.Min.X*bpp : r.Max.X*bpp]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	srcCodec, ok := d.Shape.Codec()
+	if !ok {
+		return errors.New("image shape has no codec")
+	}
+	dstCodec, _ := out.Shape.Codec()
+	px := make([]color.RGBA64, r.Dx())
+	outRow := make([]byte, out.SizeRow())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row, err := pix.ImageRow(rowBuf, img, y)
+		if err != nil {
+			return err
+		}
+		srcCodec.DecodeRow(px, row, r.Min.X)
+		dstCodec.EncodeRow(outRow, 0, px)
+		if _, err = w.Write(outRow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFloat32 writes data to w as a little endian float32 .npy array of the given shape,
+// i.e: {1, 3, height, width} for a tensor exported in NCHW layout by the tensor package.
+// data is converted and written in fixed size chunks.
+func WriteFloat32(w io.Writer, shape []int, data []float32) error {
+	h := Header{Descr: "<f4", Shape: shape}
+	if h.Len() != len(data) {
+		return errors.New("array shape does not match data length")
+	}
+	if err := WriteHeader(w, h); err != nil {
+		return err
+	}
+	const chunk = 1024
+	buf := make([]byte, 4*min(chunk, len(data)))
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		for i, v := range data[:n] {
+			binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+		}
+		if _, err := w.Write(buf[:4*n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -44,7 +44,8 @@ type Filter interface {
 	// destination buffer and returns the dimensions of the resulting image.
 	//
 	// If destination buffer is nil Filter will assert [ImageBuffered.Buffer] non-nilness
-	// and use the buffer as the destination data. In-place does not support ROI.
+	// and use the buffer as the destination data. In-place operation requires matching input and output shapes
+	// and writes the output with the source stride. An in-place ROI is written at the ROI's location in the source buffer.
 	// Use [ValidateProcessArgs] to acquire dst buffer and validate arguments.
 	//
 	// For sub-byte ROI alignment filter must implement bit-level extraction.
@@ -55,6 +56,39 @@ type Filter interface {
 	Controls() []Control
 }
 
+// DimsFilter is implemented by filters whose output width or height differ from the processed region,
+// such as resizing or rotation. Filters which do not implement DimsFilter output an image the size
+// of the ROI, or of the source image if ROI is nil.
+type DimsFilter interface {
+	Filter
+	// OutputDims returns the Width, Height and Shape of the image [Filter.Process] outputs
+	// for a source image with dimensions src and a possibly nil roi. Stride is set to [Dims.SizeRow].
+	OutputDims(src Dims, roi *image.Rectangle) (Dims, error)
+}
+
+// OutputDims returns the dimensions of the output of f for a source image with dimensions src and a possibly nil roi.
+// It calls [DimsFilter.OutputDims] if f implements it, otherwise the output has the size of the ROI or src
+// and the output shape of f. The returned Stride is [Dims.SizeRow], the stride of a packed output buffer.
+func OutputDims(f Filter, src Dims, roi *image.Rectangle) (Dims, error) {
+	if err := src.Validate(); err != nil {
+		return Dims{}, err
+	} else if roi != nil {
+		if err := validateROI(roi, src); err != nil {
+			return Dims{}, err
+		}
+	}
+	if df, ok := f.(DimsFilter); ok {
+		return df.OutputDims(src, roi)
+	}
+	out, _ := f.ShapeIO()
+	dims := Dims{Width: src.Width, Height: src.Height, Shape: out}
+	if roi != nil {
+		dims.Width, dims.Height = roi.Dx(), roi.Dy()
+	}
+	dims.Stride = dims.SizeRow()
+	return dims, dims.Validate()
+}
+
 type Shape int
 
 const (
@@ -68,13 +102,16 @@ const (
 	ShapeRGB444BE                   // rgb444be
 	ShapeGrayscale2bit              // gray2
 	ShapeMonochrome                 // monochrome
+	ShapeNRGBA8888                  // nrgba8888
+	ShapeGrayscale8bit              // gray8
+	ShapeGrayscale16BE              // gray16be
 )
 
 func (sh Shape) BitsPerPixel() (bits int) {
 	switch sh {
 	default:
 		bits = -1
-	case ShapeRGBA8888:
+	case ShapeRGBA8888, ShapeNRGBA8888:
 		bits = 32
 	case ShapeRGB888:
 		bits = 24
@@ -86,8 +123,10 @@ func (sh Shape) BitsPerPixel() (bits int) {
 		bits = 12
 	case ShapeRGB555:
 		bits = 15
-	case ShapeRGB565BE:
+	case ShapeRGB565BE, ShapeGrayscale16BE:
 		bits = 16
+	case ShapeGrayscale8bit:
+		bits = 8
 	}
 	return bits
 }
@@ -160,13 +199,16 @@ func ImageRow(dst []byte, img Image, row int) (resultSized []byte, err error) {
 // provides basic guarantees of inputs to Filter such as:
 //   - Source [Dims.Validate] early validation. Always returned as called.
 //   - Valid ROI argument.
-//   - Valid input image for buffered in-place operations. In-place rejects non-nil ROI.
+//   - Valid input image for buffered in-place operations.
 //   - shape match for in-place operations.
 //   - For users who know the output stride and height offers checking of dst buffer size.
 //     Use dstDims.Stride=0 to omit this check.
 //
 // dstDims.Shape must be set to support in-place operations. Other fields are optional but provide buffer size checks.
 // srcDims is always returned as called by src.Dims.
+//
+// For in-place operations the complete source buffer is returned. Filters must write rows with the source stride
+// and, if roi is not nil, offset the output to the ROI's location within the buffer.
 func ValidateProcessArgs(dst []byte, dstShape Dims, src Image, roi *image.Rectangle) (_ []byte, srcDims Dims, err error) {
 	srcDims = src.Dims()
 	if err = srcDims.Validate(); err != nil {
@@ -174,21 +216,14 @@ func ValidateProcessArgs(dst []byte, dstShape Dims, src Image, roi *image.Rectan
 	}
 	var requiredMinDstSize int64
 	if roi != nil {
-		if roi.Max.X < 0 || roi.Min.X < 0 || roi.Min.Y < 0 || roi.Max.Y < 0 {
-			return nil, srcDims, errors.New("negative ROI")
-		} else if roi.Max.X > srcDims.Width || roi.Max.Y > srcDims.Height {
-			return nil, srcDims, errors.New("ROI exceeds image bounds")
-		} else if roi.Empty() {
-			return nil, srcDims, errors.New("empty ROI")
+		if err = validateROI(roi, srcDims); err != nil {
+			return nil, srcDims, err
 		}
 		requiredMinDstSize = int64(dstShape.Stride) * int64(roi.Dy())
 	} else {
 		requiredMinDstSize = int64(dstShape.Stride) * int64(dstShape.Height)
 	}
 	if dst == nil {
-		if roi != nil {
-			return nil, srcDims, errors.New("in-place operation does not support ROI")
-		}
 		if dstShape.Shape != srcDims.Shape {
 			return nil, srcDims, errors.New("src must match filter output shape for in-place op")
 		}
@@ -209,3 +244,34 @@ func ValidateProcessArgs(dst []byte, dstShape Dims, src Image, roi *image.Rectan
 	}
 	return dst, srcDims, nil
 }
+
+func validateROI(roi *image.Rectangle, srcDims Dims) error {
+	if roi.Max.X < 0 || roi.Min.X < 0 || roi.Min.Y < 0 || roi.Max.Y < 0 {
+		return errors.New("negative ROI")
+	} else if roi.Max.X > srcDims.Width || roi.Max.Y > srcDims.Height {
+		return errors.New("ROI exceeds image bounds")
+	} else if roi.Empty() {
+		return errors.New("empty ROI")
+	}
+	return nil
+}
+
+// CopyBits copies n bits from src starting at bit offset srcOff to dst starting at bit offset dstOff.
+// Bit offsets count from the most significant bit of the first byte, matching the packing of sub-byte [Shape]s.
+// Bits of dst outside of the copied range are preserved. src and dst must not overlap.
+func CopyBits(dst []byte, dstOff int, src []byte, srcOff int, n int) {
+	if dstOff%8 == 0 && srcOff%8 == 0 {
+		nbytes := n / 8
+		copy(dst[dstOff/8:dstOff/8+nbytes], src[srcOff/8:srcOff/8+nbytes])
+		dstOff += 8 * nbytes
+		srcOff += 8 * nbytes
+		n -= 8 * nbytes
+	}
+	for n > 0 {
+		chunk := min(n, 16)
+		writeBits(dst, dstOff, chunk, readBits(src, srcOff, chunk))
+		dstOff += chunk
+		srcOff += chunk
+		n -= chunk
+	}
+}
@@ -0,0 +1,154 @@
+package pix
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// MemImage is an in-memory [ImageBuffered] backed by a byte slice.
+type MemImage struct {
+	dims Dims
+	buf  []byte
+}
+
+// NewMemImage returns an image with dimensions dims stored in buf.
+// If buf is nil a buffer of [Dims.Size] bytes is allocated.
+func NewMemImage(buf []byte, dims Dims) (*MemImage, error) {
+	if err := dims.Validate(); err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		buf = make([]byte, dims.Size())
+	} else if int64(len(buf)) < dims.Size() {
+		return nil, errors.New("buffer too small for image dimensions")
+	}
+	return &MemImage{dims: dims, buf: buf}, nil
+}
+
+// Dims implements [Image].
+func (m *MemImage) Dims() Dims { return m.dims }
+
+// Buffer implements [ImageBuffered].
+func (m *MemImage) Buffer() []byte { return m.buf }
+
+// ReadAt implements [io.ReaderAt].
+func (m *MemImage) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(m.buf).ReadAt(p, off)
+}
+
+// FromStdImage wraps a standard library image as an [ImageBuffered] sharing its Pix buffer.
+// Supported types are [*image.RGBA], [*image.NRGBA], [*image.Gray] and [*image.Gray16]
+// which map to [ShapeRGBA8888], [ShapeNRGBA8888], [ShapeGrayscale8bit] and [ShapeGrayscale16BE] respectively.
+// The image's bounds are honored so sub-images obtained via SubImage are also supported.
+func FromStdImage(img image.Image) (*MemImage, error) {
+	var (
+		pix    []byte
+		stride int
+		offset int
+		shape  Shape
+	)
+	r := img.Bounds()
+	switch img := img.(type) {
+	case *image.RGBA:
+		pix, stride, offset, shape = img.Pix, img.Stride, img.PixOffset(r.Min.X, r.Min.Y), ShapeRGBA8888
+	case *image.NRGBA:
+		pix, stride, offset, shape = img.Pix, img.Stride, img.PixOffset(r.Min.X, r.Min.Y), ShapeNRGBA8888
+	case *image.Gray:
+		pix, stride, offset, shape = img.Pix, img.Stride, img.PixOffset(r.Min.X, r.Min.Y), ShapeGrayscale8bit
+	case *image.Gray16:
+		pix, stride, offset, shape = img.Pix, img.Stride, img.PixOffset(r.Min.X, r.Min.Y), ShapeGrayscale16BE
+	default:
+		return nil, errors.New("unsupported image type")
+	}
+	dims := Dims{Width: r.Dx(), Height: r.Dy(), Stride: stride, Shape: shape}
+	return NewMemImage(pix[offset:], dims)
+}
+
+// StdImage wraps an [ImageBuffered] so it can be used as a standard library [draw.Image],
+// i.e: with image/draw and image/png. Pixels are read and written via the shape's [Codec].
+type StdImage struct {
+	img   ImageBuffered
+	dims  Dims
+	codec Codec
+}
+
+var _ draw.RGBA64Image = (*StdImage)(nil)
+
+// NewStdImage returns a [draw.Image] view of img. Writes through the view modify img's buffer.
+func NewStdImage(img ImageBuffered) (*StdImage, error) {
+	dims := img.Dims()
+	if err := dims.Validate(); err != nil {
+		return nil, err
+	}
+	codec, ok := dims.Shape.Codec()
+	if !ok {
+		return nil, errors.New("shape has no codec")
+	}
+	return &StdImage{img: img, dims: dims, codec: codec}, nil
+}
+
+// ColorModel implements [image.Image]. See [Shape.ColorModel].
+func (si *StdImage) ColorModel() color.Model { return si.dims.Shape.ColorModel() }
+
+// Bounds implements [image.Image]. Bounds always start at the origin.
+func (si *StdImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, si.dims.Width, si.dims.Height)
+}
+
+// At implements [image.Image].
+func (si *StdImage) At(x, y int) color.Color { return si.RGBA64At(x, y) }
+
+// RGBA64At implements [image.RGBA64Image]. Pixels out of bounds or
+// pixels that fail to be read return transparent black.
+func (si *StdImage) RGBA64At(x, y int) color.RGBA64 {
+	if !(image.Point{x, y}.In(si.Bounds())) {
+		return color.RGBA64{}
+	}
+	if buf := si.img.Buffer(); buf != nil {
+		return si.codec.Decode(buf[y*si.dims.Stride:], x)
+	}
+	c, _ := GetPixel(si.img, x, y)
+	return c
+}
+
+// Set implements [draw.Image].
+func (si *StdImage) Set(x, y int, c color.Color) {
+	si.SetRGBA64(x, y, color.RGBA64Model.Convert(c).(color.RGBA64))
+}
+
+// SetRGBA64 implements [draw.RGBA64Image]. Pixels out of bounds are ignored
+// as are writes to images with a nil buffer.
+func (si *StdImage) SetRGBA64(x, y int, c color.RGBA64) {
+	buf := si.img.Buffer()
+	if buf == nil || !(image.Point{x, y}.In(si.Bounds())) {
+		return
+	}
+	si.codec.Encode(buf[y*si.dims.Stride:], x, c)
+}
+
+// ColorModel returns a [color.Model] that converts colors to the nearest color representable by the shape.
+// Shapes with a standard library counterpart return the standard library model.
+func (sh Shape) ColorModel() color.Model {
+	switch sh {
+	case ShapeRGBA8888:
+		return color.RGBAModel
+	case ShapeNRGBA8888:
+		return color.NRGBAModel
+	case ShapeGrayscale8bit:
+		return color.GrayModel
+	case ShapeGrayscale16BE:
+		return color.Gray16Model
+	}
+	codec, ok := sh.Codec()
+	if !ok {
+		return color.RGBA64Model
+	}
+	return color.ModelFunc(func(c color.Color) color.Color {
+		var scratch [4]byte
+		codec.Encode(scratch[:], 0, color.RGBA64Model.Convert(c).(color.RGBA64))
+		return codec.Decode(scratch[:], 0)
+	})
+}
@@ -0,0 +1,87 @@
+package pix
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+func TestFromStdImage(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	gray16 := image.NewGray16(image.Rect(0, 0, 8, 6))
+	images := []draw.Image{
+		rgba,
+		image.NewNRGBA(image.Rect(0, 0, 8, 6)),
+		image.NewGray(image.Rect(0, 0, 8, 6)),
+		gray16,
+		rgba.SubImage(image.Rect(2, 1, 7, 5)).(draw.Image),
+		gray16.SubImage(image.Rect(1, 1, 3, 6)).(draw.Image),
+	}
+	for _, std := range images {
+		r := std.Bounds()
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				std.Set(x, y, color.RGBA{R: uint8(20 * x), G: uint8(30 * y), B: uint8(x * y), A: 255})
+			}
+		}
+		img, err := FromStdImage(std)
+		if err != nil {
+			t.Fatal(err)
+		} else if d := img.Dims(); d.Width != r.Dx() || d.Height != r.Dy() {
+			t.Fatalf("%T: bad dims %+v for bounds %v", std, d, r)
+		}
+		for y := 0; y < r.Dy(); y++ {
+			for x := 0; x < r.Dx(); x++ {
+				got, err := GetPixel(img, x, y)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := color.RGBA64Model.Convert(std.At(x+r.Min.X, y+r.Min.Y))
+				if got != want {
+					t.Errorf("%T: pixel (%d,%d) got %v, want %v", std, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestStdImageDrawPNG(t *testing.T) {
+	const width, height = 9, 4
+	for _, shape := range codecShapes {
+		img := newBufImage(width, height, shape)
+		std, err := NewStdImage(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := image.NewRGBA(image.Rect(0, 0, width, height))
+		for i := range src.Pix {
+			src.Pix[i] = 0xff
+		}
+		src.SetRGBA(1, 2, color.RGBA{A: 255})
+		draw.Draw(std, std.Bounds(), src, image.Point{}, draw.Src)
+		var buf bytes.Buffer
+		err = png.Encode(&buf, std)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				want := color.RGBA64{R: 0xffff, G: 0xffff, B: 0xffff, A: 0xffff}
+				if x == 1 && y == 2 {
+					want = color.RGBA64{A: 0xffff}
+				}
+				got := color.RGBA64Model.Convert(decoded.At(x, y))
+				if got != want {
+					t.Errorf("shape %d: pixel (%d,%d) got %v, want %v", shape, x, y, got, want)
+				}
+			}
+		}
+	}
+}
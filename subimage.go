@@ -0,0 +1,83 @@
+package pix
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// SubImage returns a zero-copy view of the rect region of img. The view shares img's
+// [io.ReaderAt] and, if img implements [ImageBuffered], its buffer, so it implements [ImageBuffered] too.
+// The view has the same Stride as img and its rows start at the offset of rect.Min within img.
+//
+// Pixels of sub-byte and non byte-aligned shapes can only be viewed if rect.Min.X starts
+// on a byte boundary. Otherwise SubImage returns an error and users should use
+// the roi argument of [Filter.Process] which supports bit-level alignment.
+func SubImage(img Image, rect image.Rectangle) (Image, error) {
+	d := img.Dims()
+	if err := d.Validate(); err != nil {
+		return nil, err
+	} else if rect.Empty() {
+		return nil, errors.New("empty sub-image rectangle")
+	} else if !rect.In(image.Rect(0, 0, d.Width, d.Height)) {
+		return nil, errors.New("sub-image rectangle exceeds image bounds")
+	}
+	bitOff := rect.Min.X * d.Shape.BitsPerPixel()
+	if bitOff%8 != 0 {
+		return nil, errors.New("sub-image does not start on a byte boundary")
+	}
+	sub := subImage{
+		parent: img,
+		off:    int64(rect.Min.Y)*int64(d.Stride) + int64(bitOff/8),
+		dims: Dims{
+			Width:  rect.Dx(),
+			Height: rect.Dy(),
+			Stride: d.Stride,
+			Shape:  d.Shape,
+		},
+	}
+	if buffered, ok := img.(ImageBuffered); ok {
+		return &subImageBuffered{subImage: sub, buffered: buffered}, nil
+	}
+	return &sub, nil
+}
+
+type subImage struct {
+	parent Image
+	off    int64
+	dims   Dims
+}
+
+func (s *subImage) Dims() Dims { return s.dims }
+
+func (s *subImage) ReadAt(p []byte, off int64) (int, error) {
+	size := s.dims.Size()
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	} else if off >= size {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > size-off {
+		p = p[:size-off]
+		err = io.EOF
+	}
+	n, rerr := s.parent.ReadAt(p, s.off+off)
+	if rerr != nil {
+		err = rerr
+	}
+	return n, err
+}
+
+type subImageBuffered struct {
+	subImage
+	buffered ImageBuffered
+}
+
+func (s *subImageBuffered) Buffer() []byte {
+	buf := s.buffered.Buffer()
+	if buf == nil {
+		return nil
+	}
+	return buf[s.off : s.off+s.dims.Size()]
+}
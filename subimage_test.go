@@ -0,0 +1,63 @@
+package pix
+
+import (
+	"image"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestSubImage(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, shape := range codecShapes {
+		const width, height = 24, 7
+		img := newBufImage(width, height, shape)
+		rng.Read(img.buf)
+		rect := image.Rect(8, 2, 21, 6) // Byte aligned for all shapes.
+		for _, parent := range []Image{img, readerImage{img}} {
+			sub, err := SubImage(parent, rect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, isBuffered := sub.(ImageBuffered)
+			_, wantBuffered := parent.(ImageBuffered)
+			if isBuffered != wantBuffered {
+				t.Errorf("shape %d: sub-image buffered=%v, want %v", shape, isBuffered, wantBuffered)
+			}
+			d := sub.Dims()
+			if d.Width != rect.Dx() || d.Height != rect.Dy() || d.Stride != img.dims.Stride {
+				t.Fatalf("shape %d: bad sub-image dims %+v", shape, d)
+			}
+			for y := 0; y < d.Height; y++ {
+				for x := 0; x < d.Width; x++ {
+					got, err := GetPixel(sub, x, y)
+					if err != nil {
+						t.Fatal(err)
+					}
+					want, _ := GetPixel(img, x+rect.Min.X, y+rect.Min.Y)
+					if got != want {
+						t.Errorf("shape %d: pixel (%d,%d) got %v, want %v", shape, x, y, got, want)
+					}
+				}
+			}
+			// Reads past the view's end must not leak parent data.
+			buf := make([]byte, 2*d.Size())
+			n, err := sub.ReadAt(buf, 0)
+			if n != int(d.Size()) || err != io.EOF {
+				t.Errorf("shape %d: read past end got n=%d err=%v", shape, n, err)
+			}
+		}
+	}
+}
+
+func TestSubImageUnaligned(t *testing.T) {
+	img := newBufImage(16, 4, ShapeMonochrome)
+	_, err := SubImage(img, image.Rect(3, 0, 8, 2))
+	if err == nil {
+		t.Error("expected error for sub-image not starting on byte boundary")
+	}
+	_, err = SubImage(img, image.Rect(8, 0, 17, 2))
+	if err == nil {
+		t.Error("expected error for sub-image out of bounds")
+	}
+}
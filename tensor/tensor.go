@@ -0,0 +1,227 @@
+// Package tensor exports pix images as normalized floating point tensors for machine learning models.
+package tensor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/soypat/pix"
+)
+
+// Layout is the memory order of the dimensions of an exported tensor. The batch dimension N is always 1.
+type Layout int
+
+const (
+	// LayoutNCHW stores each channel as a separate plane of rows, as expected by PyTorch and ONNX models.
+	LayoutNCHW Layout = iota
+	// LayoutNHWC stores the channels of each pixel together, as expected by TensorFlow models.
+	LayoutNHWC
+)
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutNCHW:
+		return "NCHW"
+	case LayoutNHWC:
+		return "NHWC"
+	default:
+		return "Unknown"
+	}
+}
+
+// ChannelOrder selects the channels of an exported tensor and their order.
+type ChannelOrder int
+
+const (
+	// OrderRGB exports red, green and blue channels.
+	OrderRGB ChannelOrder = iota
+	// OrderBGR exports blue, green and red channels, as expected by models trained with OpenCV.
+	OrderBGR
+	// OrderGray exports a single luminance channel computed with the weights of [color.GrayModel].
+	OrderGray
+)
+
+func (o ChannelOrder) String() string {
+	switch o {
+	case OrderRGB:
+		return "RGB"
+	case OrderBGR:
+		return "BGR"
+	case OrderGray:
+		return "Gray"
+	default:
+		return "Unknown"
+	}
+}
+
+// Channels returns the number of channels of the order.
+func (o ChannelOrder) Channels() int {
+	if o == OrderGray {
+		return 1
+	}
+	return 3
+}
+
+// Range is the range pixel values are scaled to before mean and standard deviation normalization.
+type Range int
+
+const (
+	// RangeUnit scales values to [0,1].
+	RangeUnit Range = iota
+	// RangeSigned scales values to [-1,1].
+	RangeSigned
+)
+
+func (r Range) String() string {
+	switch r {
+	case RangeUnit:
+		return "[0,1]"
+	case RangeSigned:
+		return "[-1,1]"
+	default:
+		return "Unknown"
+	}
+}
+
+// Options configures the conversion of pixels to tensor values. The zero value exports
+// an NCHW RGB tensor with values in [0,1].
+type Options struct {
+	Layout Layout
+	Order  ChannelOrder
+	Range  Range
+	// Mean and Std normalize each channel after scaling to Range as (v-Mean)/Std, i.e: the ImageNet
+	// Mean {0.485, 0.456, 0.406} and Std {0.229, 0.224, 0.225} with [RangeUnit] and [OrderRGB].
+	// They are indexed by output channel so they follow Order. A zero Std is treated as 1.
+	Mean, Std [3]float32
+}
+
+// Len returns the number of tensor elements an image of width x height pixels exports to.
+func (o Options) Len(width, height int) int {
+	return width * height * o.Order.Channels()
+}
+
+// ExportFloat32 writes the pixels of img within roi, or all of img if roi is nil, to dst as a
+// float32 tensor of shape [1, C, H, W] or [1, H, W, C] depending on opts.Layout.
+// dst must have at least [Options.Len] elements. Pixels are decoded through the codec of
+// their shape so any shape with a codec is supported. Translucent pixels are exported
+// with their alpha-premultiplied color, i.e: composited over black.
+//
+// Rows are read one at a time with [pix.ImageRow] and written directly to dst
+// so memory use does not depend on image size.
+func ExportFloat32(dst []float32, img pix.Image, roi *image.Rectangle, opts Options) error {
+	return export(dst, img, roi, opts, func(v float32) float32 { return v })
+}
+
+// ExportFloat16 is like [ExportFloat32] but writes IEEE 754 half precision values
+// as their bit patterns, rounding to nearest even.
+func ExportFloat16(dst []uint16, img pix.Image, roi *image.Rectangle, opts Options) error {
+	return export(dst, img, roi, opts, Float16)
+}
+
+func export[T float32 | uint16](dst []T, img pix.Image, roi *image.Rectangle, opts Options, conv func(float32) T) error {
+	d := img.Dims()
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	codec, ok := d.Shape.Codec()
+	if !ok {
+		return errors.New("image shape has no codec")
+	} else if opts.Layout != LayoutNCHW && opts.Layout != LayoutNHWC {
+		return errors.New("invalid tensor layout")
+	} else if opts.Order < OrderRGB || opts.Order > OrderGray {
+		return errors.New("invalid tensor channel order")
+	} else if opts.Range != RangeUnit && opts.Range != RangeSigned {
+		return errors.New("invalid tensor range")
+	}
+	r := image.Rect(0, 0, d.Width, d.Height)
+	if roi != nil {
+		if !roi.In(r) || roi.Empty() {
+			return errors.New("ROI exceeds image bounds or is empty")
+		}
+		r = *roi
+	}
+	w, h := r.Dx(), r.Dy()
+	ch := opts.Order.Channels()
+	if len(dst) < opts.Len(w, h) {
+		return errors.New("tensor slice too short for image")
+	}
+	// Scaling and normalization fold into a single multiply-add of the 16 bit value per channel.
+	var scale, offset [3]float32
+	for c := range ch {
+		std := opts.Std[c]
+		if std == 0 {
+			std = 1
+		}
+		s, o := float32(1)/0xffff, float32(0)
+		if opts.Range == RangeSigned {
+			s, o = 2*s, -1
+		}
+		scale[c], offset[c] = s/std, (o-opts.Mean[c])/std
+	}
+	// Element stride between consecutive pixels and channels of a pixel.
+	pixStride, chanStride := ch, 1
+	if opts.Layout == LayoutNCHW {
+		pixStride, chanStride = 1, w*h
+	}
+	rowBuf := make([]byte, d.SizeRow())
+	px := make([]color.RGBA64, w)
+	for y := range h {
+		row, err := pix.ImageRow(rowBuf, img, r.Min.Y+y)
+		if err != nil {
+			return err
+		}
+		codec.DecodeRow(px, row, r.Min.X)
+		base := y * w * pixStride
+		for x, c := range px {
+			var v [3]uint16
+			switch opts.Order {
+			case OrderRGB:
+				v = [3]uint16{c.R, c.G, c.B}
+			case OrderBGR:
+				v = [3]uint16{c.B, c.G, c.R}
+			default:
+				v[0] = uint16((19595*uint32(c.R) + 38470*uint32(c.G) + 7471*uint32(c.B) + 1<<15) >> 16)
+			}
+			i := base + x*pixStride
+			for k := range ch {
+				dst[i+k*chanStride] = conv(float32(v[k])*scale[k] + offset[k])
+			}
+		}
+	}
+	return nil
+}
+
+// Float16 returns the IEEE 754 half precision bits of f rounded to nearest even.
+// Values too large for half precision become infinities.
+func Float16(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	switch {
+	case b&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00 // NaN.
+	case exp >= 0x1f:
+		return sign | 0x7c00 // Overflow or infinity.
+	case exp <= 0:
+		if exp < -10 {
+			return sign // Underflow to zero.
+		}
+		// Subnormal: shift the mantissa with its implicit bit into place.
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		half := uint32(1) << (shift - 1)
+		v := mant >> shift
+		if rem := mant & (1<<shift - 1); rem > half || rem == half && v&1 == 1 {
+			v++
+		}
+		return sign | uint16(v)
+	}
+	v := uint32(exp)<<10 | mant>>13
+	if rem := mant & 0x1fff; rem > 0x1000 || rem == 0x1000 && v&1 == 1 {
+		v++ // Carry into the exponent rounds up to the next binade or infinity correctly.
+	}
+	return sign | uint16(v)
+}
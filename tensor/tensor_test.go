@@ -0,0 +1,150 @@
+package tensor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/soypat/pix"
+)
+
+func newRandomImage(t *testing.T, width, height int) (*image.RGBA, pix.Image) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	std := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range std.Pix {
+		std.Pix[i] = byte(rng.Intn(256))
+		if i%4 == 3 {
+			std.Pix[i] = 255
+		}
+	}
+	img, err := pix.FromStdImage(std)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return std, img
+}
+
+func TestExportLayouts(t *testing.T) {
+	const width, height = 7, 5
+	std, img := newRandomImage(t, width, height)
+	roi := image.Rect(1, 2, 6, 5)
+	opts := Options{
+		Mean: [3]float32{0.485, 0.456, 0.406},
+		Std:  [3]float32{0.229, 0.224, 0.225},
+	}
+	for _, order := range []ChannelOrder{OrderRGB, OrderBGR, OrderGray} {
+		for _, rng := range []Range{RangeUnit, RangeSigned} {
+			opts.Order, opts.Range = order, rng
+			w, h, ch := roi.Dx(), roi.Dy(), order.Channels()
+			nchw := make([]float32, opts.Len(w, h))
+			nhwc := make([]float32, opts.Len(w, h))
+			opts.Layout = LayoutNCHW
+			if err := ExportFloat32(nchw, img, &roi, opts); err != nil {
+				t.Fatal(err)
+			}
+			opts.Layout = LayoutNHWC
+			if err := ExportFloat32(nhwc, img, &roi, opts); err != nil {
+				t.Fatal(err)
+			}
+			for y := range h {
+				for x := range w {
+					c := std.RGBAAt(roi.Min.X+x, roi.Min.Y+y)
+					v := [3]uint8{c.R, c.G, c.B}
+					if order == OrderBGR {
+						v = [3]uint8{c.B, c.G, c.R}
+					} else if order == OrderGray {
+						v[0] = color.GrayModel.Convert(c).(color.Gray).Y
+					}
+					for k := range ch {
+						want := float32(v[k]) / 255
+						if rng == RangeSigned {
+							want = 2*want - 1
+						}
+						want = (want - opts.Mean[k]) / opts.Std[k]
+						tol := 1e-5
+						if order == OrderGray {
+							tol = 1.0 / 255 / float64(opts.Std[k]) // GrayModel truncates luma to 8 bits.
+							if rng == RangeSigned {
+								tol *= 2
+							}
+						}
+						got := nchw[k*w*h+y*w+x]
+						if math.Abs(float64(got-want)) > tol {
+							t.Fatalf("%s %s (%d,%d) channel %d: got %v, want %v", order, rng, x, y, k, got, want)
+						}
+						if alt := nhwc[(y*w+x)*ch+k]; alt != got {
+							t.Fatalf("%s %s (%d,%d) channel %d: NHWC %v differs from NCHW %v", order, rng, x, y, k, alt, got)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestExportFloat16(t *testing.T) {
+	_, img := newRandomImage(t, 6, 4)
+	opts := Options{Layout: LayoutNHWC, Range: RangeSigned}
+	f32 := make([]float32, opts.Len(6, 4))
+	f16 := make([]uint16, opts.Len(6, 4))
+	if err := ExportFloat32(f32, img, nil, opts); err != nil {
+		t.Fatal(err)
+	} else if err = ExportFloat16(f16, img, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	for i := range f16 {
+		if f16[i] != Float16(f32[i]) {
+			t.Fatalf("element %d: got %#04x, want %#04x", i, f16[i], Float16(f32[i]))
+		}
+	}
+	if err := ExportFloat16(f16[:len(f16)-1], img, nil, opts); err == nil {
+		t.Error("expected error for short tensor slice")
+	}
+}
+
+func TestFloat16(t *testing.T) {
+	tests := []struct {
+		f    float32
+		want uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{65520, 0x7c00}, // Rounds up to infinity.
+		{1e6, 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		{1.0 / 3, 0x3555},
+		{1 + 1.0/2048, 0x3c00},    // Tie rounds to even.
+		{1 + 3.0/2048, 0x3c02},    // Tie rounds to even.
+		{6.103515625e-05, 0x0400}, // Smallest normal.
+		{5.9604645e-08, 0x0001},   // Smallest subnormal.
+		{2.9802322e-08, 0x0000},   // Tie rounds to even zero.
+		{1e-10, 0x0000},
+	}
+	for _, tt := range tests {
+		if got := Float16(tt.f); got != tt.want {
+			t.Errorf("Float16(%v) = %#04x, want %#04x", tt.f, got, tt.want)
+		}
+	}
+	if got := Float16(float32(math.NaN())); got&0x7c00 != 0x7c00 || got&0x3ff == 0 {
+		t.Errorf("Float16(NaN) = %#04x, want NaN", got)
+	}
+}
+
+func TestExportInvalid(t *testing.T) {
+	_, img := newRandomImage(t, 4, 4)
+	dst := make([]float32, 48)
+	roi := image.Rect(2, 2, 5, 4)
+	if err := ExportFloat32(dst, img, &roi, Options{}); err == nil {
+		t.Error("expected error for ROI out of bounds")
+	}
+	if err := ExportFloat32(dst, img, nil, Options{Layout: 2}); err == nil {
+		t.Error("expected error for invalid layout")
+	}
+}
@@ -0,0 +1,95 @@
+package pix
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// ImageWriter is a write destination for image data which may be in-memory or elsewhere (disk, network).
+// Image rows are written at offsets separated by stride bytes as described by Dims.
+type ImageWriter interface {
+	// Dims returns the structure of the destination image.
+	// Width, Height and Shape must match the output of the filter writing to it.
+	Dims() Dims
+	io.WriterAt
+}
+
+// StreamFilter is implemented by filters that can write their output row by row
+// to an [ImageWriter] keeping memory usage bounded to a few rows.
+// Together with a streaming [Image] source this allows processing images larger than memory.
+type StreamFilter interface {
+	Filter
+	// ProcessTo processes an input image like [Filter.Process] and writes the result
+	// to dst. Use [ValidateWriterArgs] to validate arguments.
+	ProcessTo(dst ImageWriter, src Image, roi *image.Rectangle) (Dims, error)
+}
+
+// NewImageWriter returns an [ImageWriter] that writes an image with the given
+// dimensions to w, i.e: a file created with [os.Create].
+func NewImageWriter(w io.WriterAt, dims Dims) (ImageWriter, error) {
+	if err := dims.Validate(); err != nil {
+		return nil, err
+	}
+	return &imageWriter{WriterAt: w, dims: dims}, nil
+}
+
+type imageWriter struct {
+	io.WriterAt
+	dims Dims
+}
+
+func (w *imageWriter) Dims() Dims { return w.dims }
+
+// ProcessTo processes src with f and writes the result to dst. If f implements [StreamFilter]
+// the output is streamed to dst. Otherwise the output is processed into a temporary buffer
+// sized by dst's dimensions which is then written to dst row by row.
+func ProcessTo(dst ImageWriter, f Filter, src Image, roi *image.Rectangle) (Dims, error) {
+	if sf, ok := f.(StreamFilter); ok {
+		return sf.ProcessTo(dst, src, roi)
+	}
+	dstDims := dst.Dims()
+	if err := dstDims.Validate(); err != nil {
+		return Dims{}, err
+	}
+	tmpDims := dstDims
+	tmpDims.Stride = tmpDims.SizeRow()
+	buf := make([]byte, tmpDims.Size())
+	outDims, err := f.Process(buf, src, roi)
+	if err != nil {
+		return Dims{}, err
+	} else if outDims.Width != dstDims.Width || outDims.Height != dstDims.Height || outDims.Shape != dstDims.Shape {
+		return Dims{}, errors.New("filter output does not match destination dimensions")
+	}
+	rowBytes := outDims.SizeRow()
+	for y := 0; y < outDims.Height; y++ {
+		off := y * outDims.Stride
+		_, err = dst.WriteAt(buf[off:off+rowBytes], int64(y)*int64(dstDims.Stride))
+		if err != nil {
+			return Dims{}, err
+		}
+	}
+	outDims.Stride = dstDims.Stride
+	return outDims, nil
+}
+
+// ValidateWriterArgs provides the same guarantees as [ValidateProcessArgs] for
+// filters writing to an [ImageWriter]. It checks dst's dimensions are valid and
+// match outDims' Width, Height and Shape. outDims.Stride is ignored.
+func ValidateWriterArgs(dst ImageWriter, outDims Dims, src Image, roi *image.Rectangle) (dstDims, srcDims Dims, err error) {
+	srcDims = src.Dims()
+	dstDims = dst.Dims()
+	if err = srcDims.Validate(); err != nil {
+		return dstDims, srcDims, err
+	} else if roi != nil {
+		if err = validateROI(roi, srcDims); err != nil {
+			return dstDims, srcDims, err
+		}
+	}
+	if err = dstDims.Validate(); err != nil {
+		return dstDims, srcDims, err
+	} else if dstDims.Width != outDims.Width || dstDims.Height != outDims.Height || dstDims.Shape != outDims.Shape {
+		return dstDims, srcDims, errors.New("destination dimensions do not match output")
+	}
+	return dstDims, srcDims, nil
+}